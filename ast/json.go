@@ -0,0 +1,505 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rsb/monkey_interpreter/token"
+)
+
+// Every node is encoded as a JSON object holding its kind, which is the
+// name of its Go type, the pos and end of the whole node and its fields.
+// Tokens keep their type, literal and positions so that Unmarshal rebuilds
+// an identical tree. The pos and end of a node are informational and
+// ignored when decoding, they are derived from its tokens
+
+type jsonNode struct {
+	Kind string         `json:"kind"`
+	Pos  token.Position `json:"pos"`
+	End  token.Position `json:"end"`
+}
+
+func header(kind string, n Node) jsonNode {
+	return jsonNode{Kind: kind, Pos: n.Pos(), End: n.End()}
+}
+
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Statements []Statement `json:"statements"`
+	}{header("Program", p), p.Statements})
+}
+
+// UnmarshalJSON decodes a Program encoded by MarshalJSON
+func (p *Program) UnmarshalJSON(data []byte) error {
+	n, err := Unmarshal(data)
+	if err != nil {
+		return err
+	}
+
+	program, ok := n.(*Program)
+	if !ok {
+		return fmt.Errorf("ast: cannot decode %T into *ast.Program", n)
+	}
+	*p = *program
+
+	return nil
+}
+
+func (ls *LetStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token token.Token `json:"token"`
+		Name  *Identifier `json:"name"`
+		Value Expression  `json:"value"`
+	}{header("LetStatement", ls), ls.Token, ls.Name, ls.Value})
+}
+
+func (i *Identifier) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token token.Token `json:"token"`
+		Value string      `json:"value"`
+	}{header("Identifier", i), i.Token, i.Value})
+}
+
+func (rs *ReturnStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token token.Token `json:"token"`
+		Value Expression  `json:"value"`
+	}{header("ReturnStatement", rs), rs.Token, rs.Value})
+}
+
+func (es *ExpressionStatment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token      token.Token `json:"token"`
+		Expression Expression  `json:"expression"`
+	}{header("ExpressionStatment", es), es.Token, es.Expression})
+}
+
+func (il *IntegerLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token token.Token `json:"token"`
+		Value int64       `json:"value"`
+	}{header("IntegerLiteral", il), il.Token, il.Value})
+}
+
+func (fl *FloatLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token token.Token `json:"token"`
+		Value float64     `json:"value"`
+	}{header("FloatLiteral", fl), fl.Token, fl.Value})
+}
+
+func (pe *PrefixExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token    token.Token `json:"token"`
+		Operator string      `json:"operator"`
+		Right    Expression  `json:"right"`
+	}{header("PrefixExpression", pe), pe.Token, pe.Operator, pe.Right})
+}
+
+func (ie *InfixExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token    token.Token `json:"token"`
+		Left     Expression  `json:"left"`
+		Operator string      `json:"operator"`
+		Right    Expression  `json:"right"`
+	}{header("InfixExpression", ie), ie.Token, ie.Left, ie.Operator, ie.Right})
+}
+
+func (b *Boolean) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token token.Token `json:"token"`
+		Value bool        `json:"value"`
+	}{header("Boolean", b), b.Token, b.Value})
+}
+
+func (ie *IfExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token       token.Token     `json:"token"`
+		Condition   Expression      `json:"condition"`
+		Consequence *BlockStatement `json:"consequence"`
+		Alternative *BlockStatement `json:"alternative"`
+	}{header("IfExpression", ie), ie.Token, ie.Condition, ie.Consequence, ie.Alternative})
+}
+
+func (bs *BlockStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token      token.Token `json:"token"`
+		Statements []Statement `json:"statements"`
+		Rbrace     token.Token `json:"rbrace"`
+	}{header("BlockStatement", bs), bs.Token, bs.Statements, bs.Rbrace})
+}
+
+func (fl *FunctionLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token      token.Token     `json:"token"`
+		Parameters []*Identifier   `json:"parameters"`
+		Body       *BlockStatement `json:"body"`
+	}{header("FunctionLiteral", fl), fl.Token, fl.Parameters, fl.Body})
+}
+
+func (ce *CallExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token     token.Token  `json:"token"`
+		Function  Expression   `json:"function"`
+		Arguments []Expression `json:"arguments"`
+		Rparen    token.Token  `json:"rparen"`
+	}{header("CallExpression", ce), ce.Token, ce.Function, ce.Arguments, ce.Rparen})
+}
+
+func (sl *StringLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token token.Token `json:"token"`
+		Value string      `json:"value"`
+	}{header("StringLiteral", sl), sl.Token, sl.Value})
+}
+
+func (al *ArrayLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token    token.Token  `json:"token"`
+		Elements []Expression `json:"elements"`
+		Rbracket token.Token  `json:"rbracket"`
+	}{header("ArrayLiteral", al), al.Token, al.Elements, al.Rbracket})
+}
+
+// jsonPair is the encoding of a HashPair, which is not a node on its own
+type jsonPair struct {
+	Key   Expression `json:"key"`
+	Value Expression `json:"value"`
+}
+
+func (hl *HashLiteral) MarshalJSON() ([]byte, error) {
+	var pairs []jsonPair
+	if hl.Pairs != nil {
+		pairs = make([]jsonPair, len(hl.Pairs))
+		for i, pair := range hl.Pairs {
+			pairs[i] = jsonPair{Key: pair.Key, Value: pair.Value}
+		}
+	}
+
+	return json.Marshal(struct {
+		jsonNode
+		Token  token.Token `json:"token"`
+		Pairs  []jsonPair  `json:"pairs"`
+		Rbrace token.Token `json:"rbrace"`
+	}{header("HashLiteral", hl), hl.Token, pairs, hl.Rbrace})
+}
+
+func (ie *IndexExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token    token.Token `json:"token"`
+		Left     Expression  `json:"left"`
+		Index    Expression  `json:"index"`
+		Rbracket token.Token `json:"rbracket"`
+	}{header("IndexExpression", ie), ie.Token, ie.Left, ie.Index, ie.Rbracket})
+}
+
+func (le *LogicalExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token    token.Token `json:"token"`
+		Left     Expression  `json:"left"`
+		Operator string      `json:"operator"`
+		Right    Expression  `json:"right"`
+	}{header("LogicalExpression", le), le.Token, le.Left, le.Operator, le.Right})
+}
+
+func (bs *BadStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token token.Token `json:"token"`
+		To    token.Token `json:"to"`
+	}{header("BadStatement", bs), bs.Token, bs.To})
+}
+
+func (be *BadExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonNode
+		Token token.Token `json:"token"`
+		To    token.Token `json:"to"`
+	}{header("BadExpression", be), be.Token, be.To})
+}
+
+// Unmarshal decodes a node encoded by MarshalJSON, along with all of its
+// children. A JSON null decodes to a nil Node
+func Unmarshal(data []byte) (Node, error) {
+	return decodeNode(data)
+}
+
+var null = []byte("null")
+
+func decodeNode(data json.RawMessage) (Node, error) {
+	if len(data) == 0 || bytes.Equal(data, null) {
+		return nil, nil
+	}
+
+	var head struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, err
+	}
+
+	// v holds every field a node may have, the children are decoded once
+	// the kind is known
+	var v struct {
+		Token       token.Token       `json:"token"`
+		Rbrace      token.Token       `json:"rbrace"`
+		Rparen      token.Token       `json:"rparen"`
+		Rbracket    token.Token       `json:"rbracket"`
+		To          token.Token       `json:"to"`
+		Value       json.RawMessage   `json:"value"`
+		Operator    string            `json:"operator"`
+		Name        json.RawMessage   `json:"name"`
+		Expression  json.RawMessage   `json:"expression"`
+		Left        json.RawMessage   `json:"left"`
+		Right       json.RawMessage   `json:"right"`
+		Index       json.RawMessage   `json:"index"`
+		Condition   json.RawMessage   `json:"condition"`
+		Consequence json.RawMessage   `json:"consequence"`
+		Alternative json.RawMessage   `json:"alternative"`
+		Function    json.RawMessage   `json:"function"`
+		Body        json.RawMessage   `json:"body"`
+		Statements  []json.RawMessage `json:"statements"`
+		Parameters  []json.RawMessage `json:"parameters"`
+		Arguments   []json.RawMessage `json:"arguments"`
+		Elements    []json.RawMessage `json:"elements"`
+		Pairs       []struct {
+			Key   json.RawMessage `json:"key"`
+			Value json.RawMessage `json:"value"`
+		} `json:"pairs"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("ast: decoding %s: %v", head.Kind, err)
+	}
+
+	d := decoder{kind: head.Kind}
+	var n Node
+
+	switch head.Kind {
+	case "Program":
+		n = &Program{Statements: d.statements(v.Statements)}
+	case "LetStatement":
+		n = &LetStatement{Token: v.Token, Name: d.identifier(v.Name), Value: d.expression(v.Value)}
+	case "Identifier":
+		node := &Identifier{Token: v.Token}
+		d.value(v.Value, &node.Value)
+		n = node
+	case "ReturnStatement":
+		n = &ReturnStatement{Token: v.Token, Value: d.expression(v.Value)}
+	case "ExpressionStatment":
+		n = &ExpressionStatment{Token: v.Token, Expression: d.expression(v.Expression)}
+	case "IntegerLiteral":
+		node := &IntegerLiteral{Token: v.Token}
+		d.value(v.Value, &node.Value)
+		n = node
+	case "FloatLiteral":
+		node := &FloatLiteral{Token: v.Token}
+		d.value(v.Value, &node.Value)
+		n = node
+	case "PrefixExpression":
+		n = &PrefixExpression{Token: v.Token, Operator: v.Operator, Right: d.expression(v.Right)}
+	case "InfixExpression":
+		n = &InfixExpression{Token: v.Token, Left: d.expression(v.Left), Operator: v.Operator, Right: d.expression(v.Right)}
+	case "Boolean":
+		node := &Boolean{Token: v.Token}
+		d.value(v.Value, &node.Value)
+		n = node
+	case "IfExpression":
+		n = &IfExpression{
+			Token:       v.Token,
+			Condition:   d.expression(v.Condition),
+			Consequence: d.block(v.Consequence),
+			Alternative: d.block(v.Alternative),
+		}
+	case "BlockStatement":
+		n = &BlockStatement{Token: v.Token, Statements: d.statements(v.Statements), Rbrace: v.Rbrace}
+	case "FunctionLiteral":
+		n = &FunctionLiteral{Token: v.Token, Parameters: d.identifiers(v.Parameters), Body: d.block(v.Body)}
+	case "CallExpression":
+		n = &CallExpression{Token: v.Token, Function: d.expression(v.Function), Arguments: d.expressions(v.Arguments), Rparen: v.Rparen}
+	case "StringLiteral":
+		node := &StringLiteral{Token: v.Token}
+		d.value(v.Value, &node.Value)
+		n = node
+	case "ArrayLiteral":
+		n = &ArrayLiteral{Token: v.Token, Elements: d.expressions(v.Elements), Rbracket: v.Rbracket}
+	case "HashLiteral":
+		node := &HashLiteral{Token: v.Token, Rbrace: v.Rbrace}
+		if v.Pairs != nil {
+			node.Pairs = make([]HashPair, len(v.Pairs))
+			for i, pair := range v.Pairs {
+				node.Pairs[i] = HashPair{Key: d.expression(pair.Key), Value: d.expression(pair.Value)}
+			}
+		}
+		n = node
+	case "IndexExpression":
+		n = &IndexExpression{Token: v.Token, Left: d.expression(v.Left), Index: d.expression(v.Index), Rbracket: v.Rbracket}
+	case "LogicalExpression":
+		n = &LogicalExpression{Token: v.Token, Left: d.expression(v.Left), Operator: v.Operator, Right: d.expression(v.Right)}
+	case "BadStatement":
+		n = &BadStatement{Token: v.Token, To: v.To}
+	case "BadExpression":
+		n = &BadExpression{Token: v.Token, To: v.To}
+	case "":
+		return nil, fmt.Errorf("ast: node without kind")
+	default:
+		return nil, fmt.Errorf("ast: unknown node kind %q", head.Kind)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return n, nil
+}
+
+// decoder decodes the children of a node of the given kind, keeping the
+// first error so the cases of decodeNode stay readable
+type decoder struct {
+	kind string
+	err  error
+}
+
+func (d *decoder) node(data json.RawMessage) Node {
+	if d.err != nil {
+		return nil
+	}
+
+	n, err := decodeNode(data)
+	if err != nil {
+		d.err = err
+	}
+
+	return n
+}
+
+func (d *decoder) value(data json.RawMessage, v interface{}) {
+	if d.err != nil || data == nil {
+		return
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		d.err = fmt.Errorf("ast: decoding %s value: %v", d.kind, err)
+	}
+}
+
+func (d *decoder) mismatch(n Node, want string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("ast: %s cannot hold %T, want %s", d.kind, n, want)
+	}
+}
+
+func (d *decoder) statement(data json.RawMessage) Statement {
+	n := d.node(data)
+	if n == nil {
+		return nil
+	}
+
+	s, ok := n.(Statement)
+	if !ok {
+		d.mismatch(n, "a statement")
+	}
+
+	return s
+}
+
+func (d *decoder) expression(data json.RawMessage) Expression {
+	n := d.node(data)
+	if n == nil {
+		return nil
+	}
+
+	e, ok := n.(Expression)
+	if !ok {
+		d.mismatch(n, "an expression")
+	}
+
+	return e
+}
+
+func (d *decoder) identifier(data json.RawMessage) *Identifier {
+	n := d.node(data)
+	if n == nil {
+		return nil
+	}
+
+	id, ok := n.(*Identifier)
+	if !ok {
+		d.mismatch(n, "an identifier")
+	}
+
+	return id
+}
+
+func (d *decoder) block(data json.RawMessage) *BlockStatement {
+	n := d.node(data)
+	if n == nil {
+		return nil
+	}
+
+	b, ok := n.(*BlockStatement)
+	if !ok {
+		d.mismatch(n, "a block")
+	}
+
+	return b
+}
+
+// The list decoders keep the difference between a nil and an empty list
+
+func (d *decoder) statements(list []json.RawMessage) []Statement {
+	if list == nil {
+		return nil
+	}
+
+	stmts := make([]Statement, len(list))
+	for i, data := range list {
+		stmts[i] = d.statement(data)
+	}
+
+	return stmts
+}
+
+func (d *decoder) expressions(list []json.RawMessage) []Expression {
+	if list == nil {
+		return nil
+	}
+
+	exprs := make([]Expression, len(list))
+	for i, data := range list {
+		exprs[i] = d.expression(data)
+	}
+
+	return exprs
+}
+
+func (d *decoder) identifiers(list []json.RawMessage) []*Identifier {
+	if list == nil {
+		return nil
+	}
+
+	ids := make([]*Identifier, len(list))
+	for i, data := range list {
+		ids[i] = d.identifier(data)
+	}
+
+	return ids
+}
@@ -0,0 +1,174 @@
+package ast_test
+
+import (
+	"encoding/json"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/lexer"
+	"github.com/rsb/monkey_interpreter/parser"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// caseStrings returns every string constant listed in the case clauses of
+// the function called name
+func caseStrings(t *testing.T, pkg *goast.Package, name string) []string {
+	var values []string
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Name.Name != name {
+				continue
+			}
+			goast.Inspect(fn.Body, func(n goast.Node) bool {
+				clause, ok := n.(*goast.CaseClause)
+				if !ok {
+					return true
+				}
+				for _, expr := range clause.List {
+					if lit, ok := expr.(*goast.BasicLit); ok && lit.Kind == gotoken.STRING {
+						if s, err := strconv.Unquote(lit.Value); err == nil && s != "" {
+							values = append(values, s)
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+	sort.Strings(values)
+
+	return values
+}
+
+func TestJSONCoversEveryNode(t *testing.T) {
+	pkg := astPackage(t)
+	nodes := nodeTypes(t, pkg)
+	assert.NotEmpty(t, nodes)
+	assert.Equal(t, nodes, methodTypes(t, pkg, "MarshalJSON"), "every node type must implement MarshalJSON")
+	assert.Equal(t, nodes, caseStrings(t, pkg, "decodeNode"), "Unmarshal must decode every node kind")
+}
+
+// parserCorpus returns every string literal of the parser tests. Most are
+// Monkey programs, the others still parse into a tree of bad nodes worth
+// encoding
+func parserCorpus(t *testing.T) []string {
+	fset := gotoken.NewFileSet()
+	file, err := goparser.ParseFile(fset, "../parser/parser_test.go", nil, 0)
+	if err != nil {
+		t.Fatalf("parsing the parser tests: %v", err)
+	}
+
+	var corpus []string
+	goast.Inspect(file, func(n goast.Node) bool {
+		if lit, ok := n.(*goast.BasicLit); ok && lit.Kind == gotoken.STRING {
+			if s, err := strconv.Unquote(lit.Value); err == nil {
+				corpus = append(corpus, s)
+			}
+		}
+		return true
+	})
+
+	return corpus
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	corpus := parserCorpus(t)
+	assert.NotEmpty(t, corpus)
+
+	for _, input := range corpus {
+		program := parser.New(lexer.New(input)).ParseProgram()
+
+		data, err := json.Marshal(program)
+		if !assert.NoError(t, err, input) {
+			continue
+		}
+
+		var decoded ast.Program
+		if !assert.NoError(t, json.Unmarshal(data, &decoded), input) {
+			continue
+		}
+		assert.Equal(t, program, &decoded, input)
+
+		again, err := json.Marshal(&decoded)
+		if assert.NoError(t, err, input) {
+			assert.JSONEq(t, string(data), string(again), input)
+		}
+	}
+}
+
+func TestJSONEncoding(t *testing.T) {
+	program := parseProgram(t, "let x = -y;")
+
+	data, err := json.Marshal(program)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	expected := `{
+		"kind": "Program",
+		"pos": {"offset": 0, "line": 1, "column": 1},
+		"end": {"offset": 10, "line": 1, "column": 11},
+		"statements": [{
+			"kind": "LetStatement",
+			"pos": {"offset": 0, "line": 1, "column": 1},
+			"end": {"offset": 10, "line": 1, "column": 11},
+			"token": {"type": "LET", "literal": "let", "pos": {"offset": 0, "line": 1, "column": 1}, "end": {"offset": 3, "line": 1, "column": 4}},
+			"name": {
+				"kind": "Identifier",
+				"pos": {"offset": 4, "line": 1, "column": 5},
+				"end": {"offset": 5, "line": 1, "column": 6},
+				"token": {"type": "IDENT", "literal": "x", "pos": {"offset": 4, "line": 1, "column": 5}, "end": {"offset": 5, "line": 1, "column": 6}},
+				"value": "x"
+			},
+			"value": {
+				"kind": "PrefixExpression",
+				"pos": {"offset": 8, "line": 1, "column": 9},
+				"end": {"offset": 10, "line": 1, "column": 11},
+				"token": {"type": "_", "literal": "-", "pos": {"offset": 8, "line": 1, "column": 9}, "end": {"offset": 9, "line": 1, "column": 10}},
+				"operator": "-",
+				"right": {
+					"kind": "Identifier",
+					"pos": {"offset": 9, "line": 1, "column": 10},
+					"end": {"offset": 10, "line": 1, "column": 11},
+					"token": {"type": "IDENT", "literal": "y", "pos": {"offset": 9, "line": 1, "column": 10}, "end": {"offset": 10, "line": 1, "column": 11}},
+					"value": "y"
+				}
+			}
+		}]
+	}`
+	assert.JSONEq(t, expected, string(data))
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "Nope"}`, `ast: unknown node kind "Nope"`},
+		{`{}`, `ast: node without kind`},
+		{`{"kind": "Program", "statements": [{"kind": "Identifier", "value": "x"}]}`,
+			`ast: Program cannot hold *ast.Identifier, want a statement`},
+		{`{"kind": "LetStatement", "name": {"kind": "Boolean", "value": true}}`,
+			`ast: LetStatement cannot hold *ast.Boolean, want an identifier`},
+		{`{"kind": "IntegerLiteral", "value": "1"}`,
+			`ast: decoding IntegerLiteral value: json: cannot unmarshal string into Go value of type int64`},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.Unmarshal([]byte(tt.input))
+		if assert.Error(t, err, tt.input) {
+			assert.Equal(t, tt.expected, err.Error(), tt.input)
+		}
+	}
+
+	n, err := ast.Unmarshal([]byte("null"))
+	assert.NoError(t, err)
+	assert.Nil(t, n)
+}
@@ -0,0 +1,370 @@
+package ast
+
+import "fmt"
+
+// ApplyFunc is invoked by Apply for each non-nil node n, before and/or
+// after the node's children, using a Cursor describing the current
+// node and providing operations on it.
+//
+// The return value of ApplyFunc controls the syntax tree traversal. See
+// Apply for details
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses a syntax tree recursively, starting with root, and
+// calling pre and post for each node as described below. Apply returns the
+// syntax tree, possibly modified.
+//
+// If pre is not nil, it is called for each node before the node's children
+// are traversed (pre-order). If pre returns false, no children are
+// traversed, and post is not called for that node.
+//
+// If post is not nil, and a prior call of pre didn't return false, post is
+// called for each node after its children are traversed (post-order). If
+// post returns false, traversal is terminated and Apply returns
+// immediately.
+//
+// Nil children are not visited. Only fields are traversed, in the order
+// they appear in the node's struct, the keys and values of a HashLiteral
+// alternating pair by pair.
+//
+// Children are traversed in the node that was visited by pre, so a
+// replacement made in pre is not walked by Apply. Replacing the root
+// changes the returned Node
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+		result = root
+	}()
+
+	a := &application{pre: pre, post: post}
+	a.apply(nil, "", func(n Node) { root = n }, nil, root)
+
+	return root
+}
+
+// Modify replaces every node of the tree rooted at node, in post-order, by
+// the result of modifier. Returning the node unchanged keeps it
+func Modify(node Node, modifier func(Node) Node) Node {
+	return Apply(node, nil, func(c *Cursor) bool {
+		c.Replace(modifier(c.Node()))
+		return true
+	})
+}
+
+var abort = new(int) // singleton, to signal termination of Apply
+
+// A Cursor describes a node encountered during Apply. Information about the
+// node and its parent is available from the Node, Parent, Name, and Index
+// methods.
+//
+// The methods Replace, Delete, InsertBefore, and InsertAfter can be used to
+// change the syntax tree
+type Cursor struct {
+	parent Node
+	name   string
+	node   Node
+	set    func(Node)
+	list   listEditor
+	iter   *iterator
+}
+
+// Node returns the current Node
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current Node, nil for the root
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the parent Node field that contains the current
+// Node. If the parent is a *HashLiteral the name is Pairs.Key or
+// Pairs.Value
+func (c *Cursor) Name() string { return c.name }
+
+// Index reports the index >= 0 of the current Node in the slice of Nodes
+// that contains it, or a value < 0 if the current Node is not part of a
+// slice. The index of the current node changes if InsertBefore is called
+// while processing the current node
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+
+	return -1
+}
+
+// Replace replaces the current Node with n. The replacement node is not
+// walked by Apply. It panics if n cannot be stored in the parent's field
+func (c *Cursor) Replace(n Node) {
+	c.set(n)
+	c.node = n
+}
+
+// Delete deletes the current Node from its containing slice. If the current
+// Node is not part of a slice, Delete panics
+func (c *Cursor) Delete() {
+	if c.list == nil {
+		panic("Delete node not contained in slice")
+	}
+	c.list.delete(c.iter.index)
+	c.iter.step--
+}
+
+// InsertAfter inserts n after the current Node in its containing slice. If
+// the current Node is not part of a slice, InsertAfter panics. Apply does
+// not walk n
+func (c *Cursor) InsertAfter(n Node) {
+	if c.list == nil {
+		panic("InsertAfter node not contained in slice")
+	}
+	c.list.insert(c.iter.index+1, n)
+	c.iter.step++
+}
+
+// InsertBefore inserts n before the current Node in its containing slice.
+// If the current Node is not part of a slice, InsertBefore panics. Apply
+// does not walk n
+func (c *Cursor) InsertBefore(n Node) {
+	if c.list == nil {
+		panic("InsertBefore node not contained in slice")
+	}
+	c.list.insert(c.iter.index, n)
+	c.iter.index++
+}
+
+type iterator struct {
+	index, step int
+}
+
+type application struct {
+	pre, post ApplyFunc
+}
+
+func (a *application) apply(parent Node, name string, set func(Node), list listEditor, n Node) {
+	a.applyIn(parent, name, set, list, nil, n)
+}
+
+func (a *application) applyIn(parent Node, name string, set func(Node), list listEditor, iter *iterator, n Node) {
+	c := &Cursor{parent: parent, name: name, node: n, set: set, list: list, iter: iter}
+
+	if a.pre != nil && !a.pre(c) {
+		return
+	}
+
+	a.applyChildren(n)
+
+	if a.post != nil && !a.post(c) {
+		panic(abort)
+	}
+}
+
+// applyChildren visits the children of n, in the order Walk does
+func (a *application) applyChildren(n Node) {
+	switch n := n.(type) {
+	// Leaves
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean,
+		*BadStatement, *BadExpression:
+		// nothing to do
+
+	// Statements
+	case *Program:
+		a.applyList(n, "Statements", &statementList{parent: n, name: "Statements", list: &n.Statements})
+	case *LetStatement:
+		if n.Name != nil {
+			a.apply(n, "Name", func(r Node) { n.Name = asIdentifier(n, "Name", r) }, nil, n.Name)
+		}
+		if n.Value != nil {
+			a.apply(n, "Value", func(r Node) { n.Value = asExpression(n, "Value", r) }, nil, n.Value)
+		}
+	case *ReturnStatement:
+		if n.Value != nil {
+			a.apply(n, "Value", func(r Node) { n.Value = asExpression(n, "Value", r) }, nil, n.Value)
+		}
+	case *ExpressionStatment:
+		if n.Expression != nil {
+			a.apply(n, "Expression", func(r Node) { n.Expression = asExpression(n, "Expression", r) }, nil, n.Expression)
+		}
+	case *BlockStatement:
+		a.applyList(n, "Statements", &statementList{parent: n, name: "Statements", list: &n.Statements})
+
+	// Expressions
+	case *PrefixExpression:
+		a.applyExpression(n, "Right", &n.Right)
+	case *InfixExpression:
+		a.applyExpression(n, "Left", &n.Left)
+		a.applyExpression(n, "Right", &n.Right)
+	case *LogicalExpression:
+		a.applyExpression(n, "Left", &n.Left)
+		a.applyExpression(n, "Right", &n.Right)
+	case *IfExpression:
+		a.applyExpression(n, "Condition", &n.Condition)
+		if n.Consequence != nil {
+			a.apply(n, "Consequence", func(r Node) { n.Consequence = asBlock(n, "Consequence", r) }, nil, n.Consequence)
+		}
+		if n.Alternative != nil {
+			a.apply(n, "Alternative", func(r Node) { n.Alternative = asBlock(n, "Alternative", r) }, nil, n.Alternative)
+		}
+	case *FunctionLiteral:
+		a.applyList(n, "Parameters", &identifierList{parent: n, name: "Parameters", list: &n.Parameters})
+		if n.Body != nil {
+			a.apply(n, "Body", func(r Node) { n.Body = asBlock(n, "Body", r) }, nil, n.Body)
+		}
+	case *CallExpression:
+		a.applyExpression(n, "Function", &n.Function)
+		a.applyList(n, "Arguments", &expressionList{parent: n, name: "Arguments", list: &n.Arguments})
+	case *ArrayLiteral:
+		a.applyList(n, "Elements", &expressionList{parent: n, name: "Elements", list: &n.Elements})
+	case *HashLiteral:
+		for i := range n.Pairs {
+			pair := &n.Pairs[i]
+			a.applyExpression(n, "Pairs.Key", &pair.Key)
+			a.applyExpression(n, "Pairs.Value", &pair.Value)
+		}
+	case *IndexExpression:
+		a.applyExpression(n, "Left", &n.Left)
+		a.applyExpression(n, "Index", &n.Index)
+
+	default:
+		panic(fmt.Sprintf("ast.Apply: unexpected node type %T", n))
+	}
+}
+
+func (a *application) applyExpression(parent Node, name string, field *Expression) {
+	if *field == nil {
+		return
+	}
+	a.apply(parent, name, func(r Node) { *field = asExpression(parent, name, r) }, nil, *field)
+}
+
+// applyList visits every element of list. The list is re-read on each step
+// since the cursor may have deleted or inserted elements
+func (a *application) applyList(parent Node, name string, list listEditor) {
+	iter := iterator{}
+	for iter.index < list.len() {
+		iter.step = 1
+		index := iter.index
+		if n := list.at(index); n != nil {
+			a.applyIn(parent, name, func(r Node) { list.replace(iter.index, r) }, list, &iter, n)
+		}
+		iter.index += iter.step
+	}
+}
+
+// listEditor gives a Cursor access to the slice holding the current node
+type listEditor interface {
+	len() int
+	at(i int) Node
+	replace(i int, n Node)
+	delete(i int)
+	insert(i int, n Node)
+}
+
+type statementList struct {
+	parent Node
+	name   string
+	list   *[]Statement
+}
+
+func (l *statementList) len() int { return len(*l.list) }
+func (l *statementList) at(i int) Node {
+	if s := (*l.list)[i]; s != nil {
+		return s
+	}
+	return nil
+}
+func (l *statementList) replace(i int, n Node) { (*l.list)[i] = asStatement(l.parent, l.name, n) }
+func (l *statementList) delete(i int)          { *l.list = append((*l.list)[:i], (*l.list)[i+1:]...) }
+func (l *statementList) insert(i int, n Node) {
+	s := asStatement(l.parent, l.name, n)
+	*l.list = append(*l.list, nil)
+	copy((*l.list)[i+1:], (*l.list)[i:])
+	(*l.list)[i] = s
+}
+
+type expressionList struct {
+	parent Node
+	name   string
+	list   *[]Expression
+}
+
+func (l *expressionList) len() int { return len(*l.list) }
+func (l *expressionList) at(i int) Node {
+	if e := (*l.list)[i]; e != nil {
+		return e
+	}
+	return nil
+}
+func (l *expressionList) replace(i int, n Node) { (*l.list)[i] = asExpression(l.parent, l.name, n) }
+func (l *expressionList) delete(i int)          { *l.list = append((*l.list)[:i], (*l.list)[i+1:]...) }
+func (l *expressionList) insert(i int, n Node) {
+	e := asExpression(l.parent, l.name, n)
+	*l.list = append(*l.list, nil)
+	copy((*l.list)[i+1:], (*l.list)[i:])
+	(*l.list)[i] = e
+}
+
+type identifierList struct {
+	parent Node
+	name   string
+	list   *[]*Identifier
+}
+
+func (l *identifierList) len() int { return len(*l.list) }
+func (l *identifierList) at(i int) Node {
+	if id := (*l.list)[i]; id != nil {
+		return id
+	}
+	return nil
+}
+func (l *identifierList) replace(i int, n Node) { (*l.list)[i] = asIdentifier(l.parent, l.name, n) }
+func (l *identifierList) delete(i int)          { *l.list = append((*l.list)[:i], (*l.list)[i+1:]...) }
+func (l *identifierList) insert(i int, n Node) {
+	id := asIdentifier(l.parent, l.name, n)
+	*l.list = append(*l.list, nil)
+	copy((*l.list)[i+1:], (*l.list)[i:])
+	(*l.list)[i] = id
+}
+
+func asStatement(parent Node, name string, n Node) Statement {
+	if n == nil {
+		return nil
+	}
+	s, ok := n.(Statement)
+	if !ok {
+		panic(fmt.Sprintf("ast: cannot store %T in %T.%s, not a Statement", n, parent, name))
+	}
+	return s
+}
+
+func asExpression(parent Node, name string, n Node) Expression {
+	if n == nil {
+		return nil
+	}
+	e, ok := n.(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast: cannot store %T in %T.%s, not an Expression", n, parent, name))
+	}
+	return e
+}
+
+func asIdentifier(parent Node, name string, n Node) *Identifier {
+	if n == nil {
+		return nil
+	}
+	id, ok := n.(*Identifier)
+	if !ok {
+		panic(fmt.Sprintf("ast: cannot store %T in %T.%s, not an *Identifier", n, parent, name))
+	}
+	return id
+}
+
+func asBlock(parent Node, name string, n Node) *BlockStatement {
+	if n == nil {
+		return nil
+	}
+	b, ok := n.(*BlockStatement)
+	if !ok {
+		panic(fmt.Sprintf("ast: cannot store %T in %T.%s, not a *BlockStatement", n, parent, name))
+	}
+	return b
+}
@@ -0,0 +1,169 @@
+package ast_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/token"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModify(t *testing.T) {
+	one := func() ast.Expression {
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}
+	}
+	two := func() ast.Expression {
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2}
+	}
+
+	turnOneIntoTwo := func(node ast.Node) ast.Node {
+		integer, ok := node.(*ast.IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+
+		return two()
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1", "2"},
+		{"let x = 1;", "let x = 2;"},
+		{"return 1;", "return 2;"},
+		{"-1", "(-2)"},
+		{"1 + 2", "(2 + 2)"},
+		{"2 + 1", "(2 + 2)"},
+		{"1 && 1", "(2 && 2)"},
+		{"if (1) { 1 } else { 1 }", "if2 2else 2"},
+		{"fn(x) { 1 }", "fn(x) 2"},
+		{"f(1, 1)", "f(2, 2)"},
+		{"[1, 1]", "[2, 2]"},
+		{"{1: 1}", "{2: 2}"},
+		{"a[1]", "(a[2])"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		modified := ast.Modify(program, turnOneIntoTwo)
+		assert.Equal(t, tt.expected, modified.String(), tt.input)
+	}
+
+	root := ast.Modify(one(), turnOneIntoTwo)
+	assert.Equal(t, "2", root.String(), "the root is replaced")
+}
+
+func TestApplyCursor(t *testing.T) {
+	assert := assert.New(t)
+	program := parseProgram(t, "let a = 1; let b = [2, 3];")
+
+	var seen []string
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		seen = append(seen, fmt.Sprintf("%T %T.%s %d", c.Node(), c.Parent(), c.Name(), c.Index()))
+		return true
+	}, nil)
+
+	assert.Equal([]string{
+		"*ast.Program <nil>. -1",
+		"*ast.LetStatement *ast.Program.Statements 0",
+		"*ast.Identifier *ast.LetStatement.Name -1",
+		"*ast.IntegerLiteral *ast.LetStatement.Value -1",
+		"*ast.LetStatement *ast.Program.Statements 1",
+		"*ast.Identifier *ast.LetStatement.Name -1",
+		"*ast.ArrayLiteral *ast.LetStatement.Value -1",
+		"*ast.IntegerLiteral *ast.ArrayLiteral.Elements 0",
+		"*ast.IntegerLiteral *ast.ArrayLiteral.Elements 1",
+	}, seen)
+}
+
+func TestApplyDeleteAndInsert(t *testing.T) {
+	assert := assert.New(t)
+	program := parseProgram(t, "a; b; c; f(1, 2, 3)")
+
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.ExpressionStatment:
+			if n.String() == "b" {
+				c.Delete()
+			}
+			if n.String() == "c" {
+				c.InsertBefore(parseProgram(t, "x").Statements[0])
+				c.InsertAfter(parseProgram(t, "y").Statements[0])
+			}
+		case *ast.IntegerLiteral:
+			if n.Value == 2 {
+				c.Delete()
+			}
+		}
+		return true
+	}, nil)
+
+	assert.Equal("axcyf(1, 3)", program.String())
+}
+
+func TestApplyInsertedNodesAreNotWalked(t *testing.T) {
+	program := parseProgram(t, "a; b;")
+
+	var visited []string
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		if id, ok := c.Node().(*ast.Identifier); ok {
+			visited = append(visited, id.Value)
+		}
+		if _, ok := c.Node().(*ast.ExpressionStatment); ok && c.Index() == 0 {
+			c.InsertAfter(parseProgram(t, "x").Statements[0])
+		}
+		return true
+	}, nil)
+
+	assert.Equal(t, []string{"a", "b"}, visited)
+	assert.Equal(t, "axb", program.String())
+}
+
+func TestApplyPruneAndAbort(t *testing.T) {
+	assert := assert.New(t)
+	program := parseProgram(t, "f(a); g(b); h(c);")
+
+	var pre, post []string
+	result := ast.Apply(program, func(c *ast.Cursor) bool {
+		if id, ok := c.Node().(*ast.Identifier); ok {
+			pre = append(pre, id.Value)
+		}
+		call, ok := c.Node().(*ast.CallExpression)
+		return !ok || call.Function.String() != "f"
+	}, func(c *ast.Cursor) bool {
+		id, ok := c.Node().(*ast.Identifier)
+		if ok {
+			post = append(post, id.Value)
+		}
+		return !ok || id.Value != "b"
+	})
+
+	assert.Equal([]string{"g", "b"}, pre, "f(a) is pruned and h(c) is never reached")
+	assert.Equal([]string{"g", "b"}, post)
+	assert.Same(program, result, "the tree is returned when the traversal is aborted")
+}
+
+func TestApplyReplacePanicsOnMismatch(t *testing.T) {
+	program := parseProgram(t, "let x = 1;")
+
+	assert.PanicsWithValue(t, "ast: cannot store *ast.IntegerLiteral in *ast.LetStatement.Name, not an *Identifier", func() {
+		ast.Apply(program, func(c *ast.Cursor) bool {
+			if c.Name() == "Name" {
+				c.Replace(&ast.IntegerLiteral{Value: 1})
+			}
+			return true
+		}, nil)
+	})
+
+	assert.PanicsWithValue(t, "Delete node not contained in slice", func() {
+		ast.Apply(program, func(c *ast.Cursor) bool {
+			if c.Name() == "Value" {
+				c.Delete()
+			}
+			return true
+		}, nil)
+	})
+}
@@ -0,0 +1,232 @@
+package ast_test
+
+import (
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/lexer"
+	"github.com/rsb/monkey_interpreter/parser"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	for _, msg := range p.Errors() {
+		t.Errorf("parser error: %q", msg)
+	}
+
+	return program
+}
+
+// astPackage parses the source of the ast package
+func astPackage(t *testing.T) *goast.Package {
+	fset := gotoken.NewFileSet()
+	notTest := func(fi os.FileInfo) bool { return !strings.HasSuffix(fi.Name(), "_test.go") }
+	pkgs, err := goparser.ParseDir(fset, ".", notTest, 0)
+	if err != nil {
+		t.Fatalf("parsing the ast package: %v", err)
+	}
+
+	return pkgs["ast"]
+}
+
+// nodeTypes returns the name of every type of the ast package implementing
+// Node, found by looking for Pos methods in the package source
+func nodeTypes(t *testing.T, pkg *goast.Package) []string {
+	return methodTypes(t, pkg, "Pos")
+}
+
+// methodTypes returns the name of every type T with a method called name
+// declared on *T
+func methodTypes(t *testing.T, pkg *goast.Package, name string) []string {
+	var names []string
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Name.Name != name {
+				continue
+			}
+			if star, ok := fn.Recv.List[0].Type.(*goast.StarExpr); ok {
+				names = append(names, star.X.(*goast.Ident).Name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// caseTypes returns the name of every *T listed in the type switch of the
+// function or method called name
+func caseTypes(t *testing.T, pkg *goast.Package, name string) []string {
+	var names []string
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Name.Name != name {
+				continue
+			}
+			goast.Inspect(fn.Body, func(n goast.Node) bool {
+				clause, ok := n.(*goast.CaseClause)
+				if !ok {
+					return true
+				}
+				for _, expr := range clause.List {
+					if star, ok := expr.(*goast.StarExpr); ok {
+						names = append(names, star.X.(*goast.Ident).Name)
+					}
+				}
+				return true
+			})
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestWalkCoversEveryNode(t *testing.T) {
+	pkg := astPackage(t)
+	nodes := nodeTypes(t, pkg)
+	assert.NotEmpty(t, nodes)
+	assert.Equal(t, nodes, caseTypes(t, pkg, "Walk"), "ast.Walk must handle every node type")
+	assert.Equal(t, nodes, caseTypes(t, pkg, "applyChildren"), "ast.Apply must handle every node type")
+}
+
+func TestInspectOrder(t *testing.T) {
+	assert := assert.New(t)
+	program := parseProgram(t, "let x = -a + f(1, [2], {3: 4})[0]; if (x) { return; } else { x && y }")
+
+	var visited []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n == nil {
+			visited = append(visited, "nil")
+			return false
+		}
+		visited = append(visited, strings.TrimPrefix(fmtType(n), "*ast."))
+		return true
+	})
+
+	expected := []string{
+		"Program",
+		"LetStatement", "Identifier",
+		"InfixExpression",
+		"PrefixExpression", "Identifier", "nil",
+		"IndexExpression",
+		"CallExpression", "Identifier", "IntegerLiteral",
+		"ArrayLiteral", "IntegerLiteral", "nil",
+		"HashLiteral", "IntegerLiteral", "IntegerLiteral", "nil",
+		"nil",
+		"IntegerLiteral", "nil",
+		"nil", "nil",
+		"ExpressionStatment", "IfExpression", "Identifier",
+		"BlockStatement", "ReturnStatement", "nil", "nil",
+		"BlockStatement", "ExpressionStatment", "LogicalExpression", "Identifier", "Identifier", "nil", "nil", "nil",
+		"nil", "nil",
+		"nil",
+	}
+
+	// leaves get a trailing nil as well, drop those to keep the list readable
+	var compact []string
+	for i := 0; i < len(visited); i++ {
+		compact = append(compact, visited[i])
+		if isLeaf(visited[i]) && i+1 < len(visited) && visited[i+1] == "nil" {
+			i++
+		}
+	}
+
+	assert.Equal(expected, compact)
+}
+
+func TestInspectPrunes(t *testing.T) {
+	assert := assert.New(t)
+	program := parseProgram(t, "let f = fn(a, b) { a + b }; f(c, d)")
+
+	var idents []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FunctionLiteral); ok {
+			return false
+		}
+		if ident, ok := n.(*ast.Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		return true
+	})
+
+	assert.Equal([]string{"f", "f", "c", "d"}, idents)
+}
+
+type countingVisitor map[string]int
+
+func (c countingVisitor) Visit(n ast.Node) ast.Visitor {
+	if n != nil {
+		c[fmtType(n)]++
+	}
+	return c
+}
+
+func TestWalkVisitor(t *testing.T) {
+	assert := assert.New(t)
+	program := parseProgram(t, `let s = "a" + "b"; let t = 1.5 > 2 || true; s`)
+
+	counts := countingVisitor{}
+	ast.Walk(counts, program)
+
+	assert.Equal(2, counts["*ast.LetStatement"])
+	assert.Equal(2, counts["*ast.StringLiteral"])
+	assert.Equal(1, counts["*ast.FloatLiteral"])
+	assert.Equal(1, counts["*ast.Boolean"])
+	assert.Equal(1, counts["*ast.LogicalExpression"])
+	assert.Equal(3, counts["*ast.Identifier"])
+}
+
+func TestWalkSkipsNilChildren(t *testing.T) {
+	assert := assert.New(t)
+	program := parseProgram(t, "-a; a + b; a && b; if (c) { 1 } else { 2 }; fn(x) { x }; f(y); [z]; {k: v}; a[i]")
+
+	// remove every identifier, leaving the expressions without operands
+	ast.Modify(program, func(n ast.Node) ast.Node {
+		if _, ok := n.(*ast.Identifier); ok {
+			return nil
+		}
+		return n
+	})
+	ast.Modify(program, func(n ast.Node) ast.Node {
+		if _, ok := n.(*ast.BlockStatement); ok {
+			return nil
+		}
+		return n
+	})
+	program.Statements = append(program.Statements, nil)
+	array := program.Statements[6].(*ast.ExpressionStatment).Expression.(*ast.ArrayLiteral)
+	array.Elements = append(array.Elements, nil)
+
+	counts := countingVisitor{}
+	assert.NotPanics(func() { ast.Walk(counts, program) })
+	assert.Equal(0, counts["*ast.Identifier"])
+	assert.Equal(0, counts["*ast.BlockStatement"])
+	assert.Equal(1, counts["*ast.IfExpression"])
+	assert.Equal(1, counts["*ast.HashLiteral"])
+	assert.Equal(1, counts["*ast.IndexExpression"])
+}
+
+func isLeaf(name string) bool {
+	switch name {
+	case "Identifier", "IntegerLiteral", "FloatLiteral", "StringLiteral", "Boolean":
+		return true
+	}
+	return false
+}
+
+func fmtType(n ast.Node) string {
+	return fmt.Sprintf("%T", n)
+}
@@ -0,0 +1,60 @@
+// Monkey runs and inspects Monkey programs.
+//
+// Without arguments it starts the interactive REPL.
+//
+// Usage:
+//
+//	monkey <command> [arguments]
+//	monkey <file> [arguments]
+//
+// The commands are:
+//
+//	run [-O] [file] [arguments]
+//		Run a program. Its arguments are bound to args, an array of
+//		strings, and the value of the program is printed unless it is
+//		null.
+//	tokens [file]
+//		Print the tokens of a program, one per line.
+//	ast [file]
+//		Print the syntax tree of a program as JSON.
+//	fmt [-l] [-w] [file ...]
+//		Print programs in their canonical format. With -l only the names
+//		of the files whose formatting differs are printed, with -w the
+//		files are rewritten.
+//	check [file ...]
+//		Report the syntax errors of programs.
+//	build [-O] [-o output] [file]
+//		Compile a program to a bytecode file, named after the program with
+//		the .mkc extension unless -o is given. The bytecode of the
+//		standard input is written to the standard output.
+//	disasm [-O] [file]
+//		Print the instructions of a bytecode file, or of the bytecode a
+//		program compiles to annotated with its source lines.
+//
+// With -O constant expressions are folded and arithmetic identities removed
+// before a program is run or compiled, disasm lists what was changed. It
+// has no effect on bytecode files, which are compiled already.
+//
+// The standard input is read when the file is missing or is -. Bytecode
+// files are recognized by their content and run on the virtual machine,
+// programs are evaluated. A file given instead of a command is run, so a
+// script starting with
+//
+//	#!/usr/bin/env monkey
+//
+// can be made executable.
+//
+// The exit status is 0 on success, 1 when the program fails at run time, 2
+// on a usage or I/O error, including an unreadable bytecode file, and 3 when
+// the program does not parse or compile.
+package main
+
+import (
+	"os"
+
+	"github.com/rsb/monkey_interpreter/internal/cli"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,197 @@
+// Monkeyfmt formats Monkey programs.
+//
+// Without an explicit path it processes the standard input. Given a file it
+// operates on that file, given a directory it operates on every .mk file in
+// it, recursively.
+//
+// Usage:
+//
+//	monkeyfmt [flags] [path ...]
+//
+// The flags are:
+//
+//	-d
+//		Do not print reformatted sources to standard output.
+//		If a file's formatting is different than monkeyfmt's, print diffs
+//		to standard output.
+//	-w
+//		Do not print reformatted sources to standard output.
+//		If a file's formatting is different from monkeyfmt's, overwrite it
+//		with monkeyfmt's version.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rsb/monkey_interpreter/format"
+)
+
+var (
+	write = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	diff  = flag.Bool("d", false, "display diffs instead of rewriting files")
+)
+
+// exitCode is set to 2 by any file that could not be formatted
+var exitCode = 0
+
+func report(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	exitCode = 2
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: monkeyfmt [flags] [path ...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "error: cannot use -w with standard input")
+			os.Exit(2)
+		}
+		if err := processFile("<standard input>", os.Stdin, os.Stdout); err != nil {
+			report(err)
+		}
+		os.Exit(exitCode)
+	}
+
+	for _, path := range flag.Args() {
+		switch info, err := os.Stat(path); {
+		case err != nil:
+			report(err)
+		case info.IsDir():
+			walkDir(path)
+		default:
+			if err := processFile(path, nil, os.Stdout); err != nil {
+				report(err)
+			}
+		}
+	}
+
+	os.Exit(exitCode)
+}
+
+func isMonkeyFile(info os.FileInfo) bool {
+	name := info.Name()
+	return !info.IsDir() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".mk")
+}
+
+func walkDir(path string) {
+	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err == nil && isMonkeyFile(info) {
+			err = processFile(path, nil, os.Stdout)
+		}
+		if err != nil {
+			report(err)
+		}
+		return nil
+	})
+	if err != nil {
+		report(err)
+	}
+}
+
+// processFile formats the file at filename, read from in if it is not nil,
+// and writes the result to out or back to the file depending on the flags
+func processFile(filename string, in io.Reader, out io.Writer) error {
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	res, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("%s:%v", filename, err)
+	}
+
+	if !*write && !*diff {
+		_, err = out.Write(res)
+		return err
+	}
+
+	if bytes.Equal(src, res) {
+		return nil
+	}
+
+	if *write {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if *diff {
+		data, err := diffSources(src, res, filename)
+		if err != nil {
+			return fmt.Errorf("computing diff: %s", err)
+		}
+		out.Write(data)
+	}
+
+	return nil
+}
+
+// diffSources returns a unified diff of b1 and b2 computed by the system's
+// diff command, like gofmt does
+func diffSources(b1, b2 []byte, filename string) ([]byte, error) {
+	f1, err := writeTempFile("monkeyfmt", b1)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f1)
+
+	f2, err := writeTempFile("monkeyfmt", b2)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f2)
+
+	data, err := exec.Command("diff", "-u", "--label", filename+".orig", "--label", filename, f1, f2).CombinedOutput()
+	if len(data) > 0 {
+		// diff exits with a non-zero status when the files don't match
+		return data, nil
+	}
+
+	return data, err
+}
+
+func writeTempFile(prefix string, data []byte) (string, error) {
+	f, err := ioutil.TempFile("", prefix)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
@@ -0,0 +1,267 @@
+// Package code defines the instruction set of the Monkey virtual machine
+// and how instructions are encoded.
+//
+// An instruction is an opcode byte followed by its operands, each stored
+// big endian on the number of bytes given by the opcode's Definition
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions is a sequence of encoded instructions
+type Instructions []byte
+
+// String disassembles ins, one instruction per line prefixed by its offset
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	for i := 0; i < len(ins); {
+		text, width := ins.Instruction(i)
+		fmt.Fprintf(&out, "%04d %s\n", i, text)
+		i += width
+	}
+
+	return out.String()
+}
+
+// Instruction disassembles the instruction at offset i and returns it with
+// its width. An undefined opcode is reported as one byte wide so the
+// following ones can still be read
+func (ins Instructions) Instruction(i int) (string, int) {
+	def, err := Lookup(ins[i])
+	if err != nil {
+		return fmt.Sprintf("ERROR: %s", err), 1
+	}
+
+	if i+def.Width() > len(ins) {
+		return fmt.Sprintf("ERROR: %s is truncated", def.Name), len(ins) - i
+	}
+
+	operands, read := ReadOperands(def, ins[i+1:])
+
+	return fmtInstruction(def, operands), 1 + read
+}
+
+func fmtInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d", len(operands), len(def.OperandWidths))
+	}
+
+	switch len(operands) {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operand count for %s", def.Name)
+}
+
+type Opcode byte
+
+const (
+	// OpConstant pushes the constant at the index given by its operand
+	OpConstant Opcode = iota
+	// OpPop discards the top of the stack
+	OpPop
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterEqual
+	OpLessThan
+	OpLessEqual
+
+	OpMinus
+	OpBang
+
+	// OpJumpNotTruthy pops the condition and jumps to the absolute offset
+	// given by its operand if the condition is false or null
+	OpJumpNotTruthy
+	OpJump
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	// OpGetFree pushes a variable captured by the running closure
+	OpGetFree
+	// OpCurrentClosure pushes the running closure, for recursive calls
+	OpCurrentClosure
+
+	// OpArray builds an array out of the number of elements given by its
+	// operand
+	OpArray
+	// OpHash builds a hash out of the number of keys and values given by
+	// its operand, twice the number of pairs
+	OpHash
+	OpIndex
+
+	// OpCall calls the function below the number of arguments given by its
+	// operand
+	OpCall
+	// OpReturnValue returns the top of the stack from the running function
+	OpReturnValue
+	// OpReturn returns null from the running function
+	OpReturn
+	// OpClosure wraps the function constant given by its first operand in a
+	// closure capturing the number of free variables given by the second
+	OpClosure
+	// OpGetCell pushes the value held by the cell in the local slot given
+	// by its operand
+	OpGetCell
+	// OpSetCell pops a value into the cell in the local slot given by its
+	// operand, putting a new cell in the slot if it holds none
+	OpSetCell
+	// OpGetFreeCell pushes the value held by a cell captured by the running
+	// closure
+	OpGetFreeCell
+	// OpCaptureCell pushes the cell in the local slot given by its operand,
+	// putting one holding null in the slot if it holds none, for a closure
+	// to capture
+	OpCaptureCell
+)
+
+// Definition describes an opcode for the assembler and the disassembler
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+	OpMod: {"OpMod", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpClosure:     {"OpClosure", []int{2, 1}},
+
+	OpGetCell:     {"OpGetCell", []int{1}},
+	OpSetCell:     {"OpSetCell", []int{1}},
+	OpGetFreeCell: {"OpGetFreeCell", []int{1}},
+	OpCaptureCell: {"OpCaptureCell", []int{1}},
+}
+
+// Width returns the number of bytes of an instruction, opcode included
+func (def *Definition) Width() int {
+	width := 1
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+
+	return width
+}
+
+// Lookup returns the definition of op
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes the instruction op with its operands. It returns an empty
+// instruction if op is not defined
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instruction := make([]byte, def.Width())
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction described by def
+// from ins, which starts right after the opcode. It returns them with the
+// number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
@@ -0,0 +1,105 @@
+package code_test
+
+import (
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/code"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       code.Opcode
+		operands []int
+		expected []byte
+	}{
+		{code.OpConstant, []int{65534}, []byte{byte(code.OpConstant), 255, 254}},
+		{code.OpAdd, []int{}, []byte{byte(code.OpAdd)}},
+		{code.OpGetLocal, []int{255}, []byte{byte(code.OpGetLocal), 255}},
+		{code.OpClosure, []int{65534, 255}, []byte{byte(code.OpClosure), 255, 254, 255}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, code.Make(tt.op, tt.operands...))
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []code.Instructions{
+		code.Make(code.OpAdd),
+		code.Make(code.OpGetLocal, 1),
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpConstant, 65535),
+		code.Make(code.OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+	var concatted code.Instructions
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	assert.Equal(t, expected, concatted.String())
+}
+
+func TestInstructionsStringMalformed(t *testing.T) {
+	ins := code.Instructions{255, byte(code.OpConstant), 1}
+
+	assert.Equal(t, "0000 ERROR: opcode 255 undefined\n0001 ERROR: OpConstant is truncated\n", ins.String())
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        code.Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{code.OpConstant, []int{65535}, 2},
+		{code.OpGetLocal, []int{255}, 1},
+		{code.OpClosure, []int{65535, 255}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := code.Make(tt.op, tt.operands...)
+
+		def, err := code.Lookup(byte(tt.op))
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		operandsRead, n := code.ReadOperands(def, instruction[1:])
+		assert.Equal(t, tt.bytesRead, n)
+		assert.Equal(t, tt.operands, operandsRead)
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	assert := assert.New(t)
+
+	var lines code.LineTable
+	lines = lines.Add(0, 1)
+	lines = lines.Add(3, 1)
+	lines = lines.Add(4, 2)
+	lines = lines.Add(4, 3)
+	lines = lines.Add(7, 5)
+	assert.Equal(code.LineTable{{Offset: 0, Line: 1}, {Offset: 4, Line: 3}, {Offset: 7, Line: 5}}, lines)
+
+	for offset, line := range []int{1, 1, 1, 1, 3, 3, 3, 5, 5} {
+		assert.Equal(line, lines.Line(offset), "offset %d", offset)
+	}
+	assert.Equal(0, code.LineTable{}.Line(0))
+	assert.Equal(0, code.LineTable{{Offset: 2, Line: 1}}.Line(1))
+
+	assert.Equal(code.LineTable{{Offset: 0, Line: 1}, {Offset: 4, Line: 3}}, lines.Truncate(5))
+	assert.Equal(code.LineTable{{Offset: 0, Line: 1}}, lines.Truncate(4))
+
+	// an entry replaced by one with the line of the previous entry merges
+	assert.Equal(code.LineTable{{Offset: 0, Line: 1}}, code.LineTable{{Offset: 0, Line: 1}, {Offset: 2, Line: 2}}.Add(2, 1))
+}
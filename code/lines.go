@@ -0,0 +1,44 @@
+package code
+
+import "sort"
+
+// LineTable maps the offsets of instructions to the source lines they were
+// compiled from. An entry applies from its offset up to the next entry
+type LineTable []LineEntry
+
+type LineEntry struct {
+	Offset int
+	Line   int
+}
+
+// Line returns the source line of the instruction at offset, 0 if it is
+// not known
+func (t LineTable) Line(offset int) int {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 {
+		return 0
+	}
+
+	return t[i-1].Line
+}
+
+// Add records that the instructions from offset on come from line. Offsets
+// have to be added in increasing order
+func (t LineTable) Add(offset, line int) LineTable {
+	n := len(t)
+	if n > 0 && t[n-1].Offset == offset {
+		t, n = t[:n-1], n-1
+	}
+	if n > 0 && t[n-1].Line == line {
+		return t
+	}
+
+	return append(t, LineEntry{Offset: offset, Line: line})
+}
+
+// Truncate drops the entries of the instructions from offset on
+func (t LineTable) Truncate(offset int) LineTable {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset >= offset })
+
+	return t[:i]
+}
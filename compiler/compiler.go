@@ -0,0 +1,631 @@
+// Package compiler lowers a parsed Monkey program to bytecode for the
+// virtual machine of package vm.
+//
+// Programs compile to the same results Eval produces, with one difference:
+// a name has to be bound before the code using it is compiled, so
+// functions cannot call functions defined after them
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/code"
+	"github.com/rsb/monkey_interpreter/object"
+	"github.com/rsb/monkey_interpreter/token"
+)
+
+// limits set by the width of the operands
+const (
+	maxConstants = 1<<16 - 1
+	maxGlobals   = 1<<16 - 1
+	maxLocals    = 1<<8 - 1
+	maxArguments = 1<<8 - 1
+	maxJump      = 1<<16 - 1
+	maxElements  = 1<<16 - 1
+)
+
+// Error reports a program that cannot be compiled
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+func newError(node ast.Node, format string, a ...interface{}) *Error {
+	return &Error{Pos: node.Pos(), Message: fmt.Sprintf(format, a...)}
+}
+
+// EmittedInstruction records the opcode and offset of an instruction
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of the function being compiled
+// and the source lines they come from
+type CompilationScope struct {
+	instructions        code.Instructions
+	lines               code.LineTable
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// line is the source line of the node being compiled
+	line int
+}
+
+// Bytecode is the result of a compilation: the instructions of the main
+// program, the source lines they come from and the constants they refer to
+type Bytecode struct {
+	Instructions code.Instructions
+	Lines        code.LineTable
+	Constants    []object.Object
+}
+
+func New() *Compiler {
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: NewSymbolTable(),
+		scopes:      []CompilationScope{{instructions: code.Instructions{}}},
+	}
+}
+
+// NewWithState returns a compiler that keeps the bindings and constants of
+// a previous compilation, for a REPL running each input on the same globals
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	c := New()
+	c.symbolTable = s
+	c.constants = constants
+
+	return c
+}
+
+// Compile adds the instructions for node to the current scope
+func (c *Compiler) Compile(node ast.Node) error {
+	if line := node.Pos().Line; line > 0 {
+		defer func(line int) { c.line = line }(c.line)
+		c.line = line
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+		// like Eval, a program that does not end with an expression is
+		// null
+		if !c.lastInstructionIs(code.OpPop) {
+			if n := len(node.Statements); n > 0 {
+				c.line = node.Statements[n-1].Pos().Line
+			}
+			c.emit(code.OpNull)
+			c.emit(code.OpPop)
+		}
+	case *ast.ExpressionStatment:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		return c.compileLetStatement(node)
+	case *ast.ReturnStatement:
+		if node.Value == nil {
+			c.emit(code.OpNull)
+		} else if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return newError(node, "identifier not found: %s", node.Value)
+		}
+		c.loadSymbol(symbol)
+	case *ast.IntegerLiteral:
+		return c.emitConstant(node, &object.Integer{Value: node.Value})
+	case *ast.FloatLiteral:
+		return c.emitConstant(node, &object.Float{Value: node.Value})
+	case *ast.StringLiteral:
+		return c.emitConstant(node, &object.String{Value: node.Value})
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		return c.compilePrefixExpression(node)
+	case *ast.InfixExpression:
+		return c.compileInfixExpression(node)
+	case *ast.LogicalExpression:
+		return c.compileLogicalExpression(node)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "")
+	case *ast.CallExpression:
+		if len(node.Arguments) > maxArguments {
+			return newError(node, "too many arguments, the limit is %d", maxArguments)
+		}
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.ArrayLiteral:
+		if len(node.Elements) > maxElements {
+			return newError(node, "too many elements, the limit is %d", maxElements)
+		}
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		// keys and values are counted together
+		if len(node.Pairs) > maxElements/2 {
+			return newError(node, "too many pairs, the limit is %d", maxElements/2)
+		}
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.BadStatement:
+		return newError(node, "cannot compile malformed statement")
+	case *ast.BadExpression:
+		return newError(node, "cannot compile malformed expression")
+	default:
+		return fmt.Errorf("compiler: unexpected node %T", node)
+	}
+
+	return nil
+}
+
+// Bytecode returns the instructions of the main program and the constants
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Lines:        c.scopes[c.scopeIndex].lines,
+		Constants:    c.constants,
+	}
+}
+
+// SymbolTable returns the global bindings, to be passed to NewWithState
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
+	// the value is compiled before the name is bound so that it still sees
+	// the previous binding, a function refers to itself through its name
+	var err error
+	if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+		err = c.compileFunction(fn, node.Name.Value)
+	} else if node.Value == nil {
+		c.emit(code.OpNull)
+	} else {
+		err = c.Compile(node.Value)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the number of locals is checked once the function is compiled
+	symbol := c.symbolTable.Define(node.Name.Value)
+	switch symbol.Scope {
+	case GlobalScope:
+		if symbol.Index > maxGlobals {
+			return newError(node, "too many global bindings, the limit is %d", maxGlobals)
+		}
+		c.emit(code.OpSetGlobal, symbol.Index)
+	case CellScope:
+		c.emit(code.OpSetCell, symbol.Index)
+	default:
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compilePrefixExpression(node *ast.PrefixExpression) error {
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+
+	switch node.Operator {
+	case "!":
+		c.emit(code.OpBang)
+	case "-":
+		c.emit(code.OpMinus)
+	default:
+		return newError(node, "unknown operator: %s", node.Operator)
+	}
+
+	return nil
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	">=": code.OpGreaterEqual,
+	"<":  code.OpLessThan,
+	"<=": code.OpLessEqual,
+}
+
+func (c *Compiler) compileInfixExpression(node *ast.InfixExpression) error {
+	op, ok := infixOperators[node.Operator]
+	if !ok {
+		return newError(node, "unknown operator: %s", node.Operator)
+	}
+
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	c.emit(op)
+
+	return nil
+}
+
+// compileLogicalExpression only runs the right operand when the left one
+// does not decide the result. Two OpBang turn the operand into the boolean
+// the evaluator produces
+func (c *Compiler) compileLogicalExpression(node *ast.LogicalExpression) error {
+	if node.Operator != "&&" && node.Operator != "||" {
+		return newError(node, "unknown operator: %s", node.Operator)
+	}
+
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if node.Operator == "&&" {
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(code.OpBang)
+		c.emit(code.OpBang)
+	} else {
+		c.emit(code.OpTrue)
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	if err := c.patchJump(node, jumpNotTruthyPos); err != nil {
+		return err
+	}
+	if node.Operator == "&&" {
+		c.emit(code.OpFalse)
+	} else {
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(code.OpBang)
+		c.emit(code.OpBang)
+	}
+	if err := c.patchJump(node, jumpPos); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	// the operands are set once the targets are known
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	if err := c.patchJump(node, jumpNotTruthyPos); err != nil {
+		return err
+	}
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alternative); err != nil {
+		return err
+	}
+	if err := c.patchJump(node, jumpPos); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// compileBlockValue compiles a block leaving its value on the stack: the
+// value of its last statement if it is an expression, null otherwise
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// compileFunction emits a closure for fn. A non-empty name is the one the
+// function is bound to, it resolves to the closure itself in the body
+func (c *Compiler) compileFunction(fn *ast.FunctionLiteral, name string) error {
+	if len(fn.Parameters) > maxArguments {
+		return newError(fn, "too many parameters, the limit is %d", maxArguments)
+	}
+
+	c.enterScope()
+	c.symbolTable.captured = capturedNames(fn)
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+	for _, p := range fn.Parameters {
+		// captured parameters are moved to a cell on entry
+		if symbol := c.symbolTable.DefineParameter(p.Value); symbol.Scope == CellScope {
+			c.emit(code.OpGetLocal, symbol.Index)
+			c.emit(code.OpSetCell, symbol.Index)
+		}
+	}
+
+	if err := c.Compile(fn.Body); err != nil {
+		return err
+	}
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumDefinitions()
+	instructions, lines := c.leaveScope()
+
+	if numLocals > maxLocals {
+		return newError(fn, "too many local bindings, the limit is %d", maxLocals)
+	}
+
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		Lines:         lines,
+		NumLocals:     numLocals,
+		NumParameters: len(fn.Parameters),
+	}
+	index, err := c.addConstant(fn, compiledFn)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpClosure, index, len(freeSymbols))
+
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	case CellScope:
+		c.emit(code.OpGetCell, s.Index)
+	case FreeCellScope:
+		c.emit(code.OpGetFreeCell, s.Index)
+	}
+}
+
+// captureSymbol pushes what a closure captures for s: the cell itself for
+// the symbols held in one, the value otherwise
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case CellScope:
+		c.emit(code.OpCaptureCell, s.Index)
+	case FreeCellScope:
+		c.emit(code.OpGetFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+// capturedNames returns the names used by the functions nested in fn. The
+// locals of fn they may refer to are kept in cells, a name shadowed in the
+// nested function only costs an unneeded cell
+func capturedNames(fn *ast.FunctionLiteral) map[string]bool {
+	names := map[string]bool{}
+	if fn.Body == nil {
+		return names
+	}
+
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		inner, ok := n.(*ast.FunctionLiteral)
+		if !ok {
+			return true
+		}
+		ast.Inspect(inner, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Identifier); ok {
+				names[ident.Value] = true
+			}
+			return true
+		})
+		return false
+	})
+
+	return names
+}
+
+func (c *Compiler) addConstant(node ast.Node, obj object.Object) (int, error) {
+	if len(c.constants) > maxConstants {
+		return 0, newError(node, "too many constants, the limit is %d", maxConstants)
+	}
+	c.constants = append(c.constants, obj)
+
+	return len(c.constants) - 1, nil
+}
+
+func (c *Compiler) emitConstant(node ast.Node, obj object.Object) error {
+	index, err := c.addConstant(node, obj)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpConstant, index)
+
+	return nil
+}
+
+// emit appends an instruction to the current scope and returns its offset
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	c.scopes[c.scopeIndex].lines = c.scopes[c.scopeIndex].lines.Add(posNewInstruction, c.line)
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lines = c.scopes[c.scopeIndex].lines.Truncate(last.Position)
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	copy(ins[pos:], newInstruction)
+}
+
+// patchJump makes the jump at opPos go to the next instruction. The target
+// has to fit in the operand, so the instructions of a scope are limited to
+// maxJump bytes once they contain a jump
+func (c *Compiler) patchJump(node ast.Node, opPos int) error {
+	target := len(c.currentInstructions())
+	if target > maxJump {
+		return newError(node, "too much code to jump over, the limit is %d bytes", maxJump)
+	}
+	c.changeOperand(opPos, target)
+
+	return nil
+}
+
+// changeOperand rewrites the operand of the instruction at opPos
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() (code.Instructions, code.LineTable) {
+	instructions := c.currentInstructions()
+	lines := c.scopes[c.scopeIndex].lines
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions, lines
+}
@@ -0,0 +1,75 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rsb/monkey_interpreter/code"
+	"github.com/rsb/monkey_interpreter/object"
+)
+
+// Disassemble writes a listing of b to w: the constants, then the
+// instructions of the main program and of every function. Instructions
+// are grouped under the source line they were compiled from, quoted from
+// src unless it is empty
+func Disassemble(w io.Writer, b *Bytecode, src string) error {
+	var out bytes.Buffer
+	var lines []string
+	if src != "" {
+		lines = strings.Split(src, "\n")
+	}
+
+	if len(b.Constants) > 0 {
+		out.WriteString("constants:\n")
+		for i, constant := range b.Constants {
+			fmt.Fprintf(&out, "\t%d\t%s\n", i, describeConstant(constant))
+		}
+		out.WriteString("\n")
+	}
+
+	out.WriteString("main:\n")
+	disassembleInstructions(&out, b.Instructions, b.Lines, lines)
+
+	for i, constant := range b.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			fmt.Fprintf(&out, "\nfunction %d:\n", i)
+			disassembleInstructions(&out, fn.Instructions, fn.Lines, lines)
+		}
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func describeConstant(constant object.Object) string {
+	switch constant := constant.(type) {
+	case *object.String:
+		return fmt.Sprintf("STRING %q", constant.Value)
+	case *object.CompiledFunction:
+		return fmt.Sprintf("FUNCTION %d parameters, %d locals", constant.NumParameters, constant.NumLocals)
+	}
+
+	return fmt.Sprintf("%s %s", constant.Type(), constant.Inspect())
+}
+
+func disassembleInstructions(out *bytes.Buffer, ins code.Instructions, table code.LineTable, lines []string) {
+	line := 0
+	for i := 0; i < len(ins); {
+		if l := table.Line(i); l != line {
+			line = l
+			switch {
+			case line <= 0:
+			case line <= len(lines):
+				fmt.Fprintf(out, "\t; %d | %s\n", line, strings.TrimRight(lines[line-1], "\r"))
+			default:
+				fmt.Fprintf(out, "\t; line %d\n", line)
+			}
+		}
+
+		text, width := ins.Instruction(i)
+		fmt.Fprintf(out, "\t%04d %s\n", i, text)
+		i += width
+	}
+}
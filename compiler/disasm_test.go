@@ -0,0 +1,56 @@
+package compiler_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/compiler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisassemble(t *testing.T) {
+	assert := assert.New(t)
+
+	input := `let greet = fn(name) {
+	"hello " + name
+};
+greet("monkey")`
+
+	bytecode, err := compile(t, input)
+	if !assert.NoError(err) {
+		return
+	}
+
+	expected := `constants:
+	0	STRING "hello "
+	1	FUNCTION 1 parameters, 1 locals
+	2	STRING "monkey"
+
+main:
+	; 1 | let greet = fn(name) {
+	0000 OpClosure 1 0
+	0004 OpSetGlobal 0
+	; 4 | greet("monkey")
+	0007 OpGetGlobal 0
+	0010 OpConstant 2
+	0013 OpCall 1
+	0015 OpPop
+
+function 1:
+	; 2 | 	"hello " + name
+	0000 OpConstant 0
+	0003 OpGetLocal 0
+	0005 OpAdd
+	0006 OpReturnValue
+`
+
+	var out bytes.Buffer
+	assert.NoError(compiler.Disassemble(&out, bytecode, input))
+	assert.Equal(expected, out.String())
+
+	// without the source only the line numbers are known
+	out.Reset()
+	assert.NoError(compiler.Disassemble(&out, bytecode, ""))
+	assert.Contains(out.String(), "main:\n\t; line 1\n\t0000 OpClosure 1 0\n")
+}
@@ -0,0 +1,300 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/rsb/monkey_interpreter/code"
+	"github.com/rsb/monkey_interpreter/object"
+)
+
+// A bytecode file, conventionally named with the .mkc extension, holds
+// a Bytecode. Numbers are stored big endian:
+//
+//	magic        "\x7fMKC"
+//	version      uint16
+//	constants    uint32 count, then each constant
+//	instructions the main program, see below
+//	checksum     uint32, CRC-32 (IEEE) of everything before it
+//
+// A constant is a tag byte followed by its value:
+//
+//	'i' integer  int64
+//	'f' float    IEEE 754 bits as uint64
+//	's' string   uint32 length, then UTF-8 bytes
+//	'c' function uint16 number of locals, uint16 number of parameters,
+//	             then its instructions
+//
+// Instructions are stored as a uint32 length followed by the bytes, then
+// the line table as a uint32 count of uint32 offset and line pairs
+const (
+	BytecodeMagic   = "\x7fMKC"
+	BytecodeVersion = 1
+)
+
+const (
+	tagInteger  = 'i'
+	tagFloat    = 'f'
+	tagString   = 's'
+	tagFunction = 'c'
+)
+
+// ErrNotBytecode is returned by Decode for data not starting with
+// BytecodeMagic
+var ErrNotBytecode = errors.New("compiler: not a Monkey bytecode file")
+
+// VersionError is returned by Decode for a file written by a version of the
+// compiler producing a different BytecodeVersion
+type VersionError struct {
+	Version int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("compiler: bytecode version %d is not supported, want version %d", e.Version, BytecodeVersion)
+}
+
+// CorruptError is returned by Decode for a damaged or inconsistent file
+type CorruptError struct {
+	Message string
+}
+
+func (e *CorruptError) Error() string {
+	return "compiler: corrupt bytecode file: " + e.Message
+}
+
+func corrupt(format string, a ...interface{}) *CorruptError {
+	return &CorruptError{Message: fmt.Sprintf(format, a...)}
+}
+
+// IsBytecode reports whether data starts like a bytecode file
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(BytecodeMagic))
+}
+
+// Encode writes b to w in the bytecode file format
+func Encode(w io.Writer, b *Bytecode) error {
+	var e encoder
+	e.buf.WriteString(BytecodeMagic)
+	e.uint16(BytecodeVersion)
+
+	e.uint32(len(b.Constants))
+	for i, constant := range b.Constants {
+		if err := e.constant(constant); err != nil {
+			return fmt.Errorf("compiler: encoding constant %d: %v", i, err)
+		}
+	}
+	e.instructions(b.Instructions, b.Lines)
+
+	e.uint32(int(crc32.ChecksumIEEE(e.buf.Bytes())))
+
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uint16(v int) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(v))
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) uint32(v int) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) constant(constant object.Object) error {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(tagInteger)
+		e.uint64(uint64(constant.Value))
+	case *object.Float:
+		e.buf.WriteByte(tagFloat)
+		e.uint64(math.Float64bits(constant.Value))
+	case *object.String:
+		e.buf.WriteByte(tagString)
+		e.uint32(len(constant.Value))
+		e.buf.WriteString(constant.Value)
+	case *object.CompiledFunction:
+		e.buf.WriteByte(tagFunction)
+		e.uint16(constant.NumLocals)
+		e.uint16(constant.NumParameters)
+		e.instructions(constant.Instructions, constant.Lines)
+	default:
+		return fmt.Errorf("unsupported constant type %s", constant.Type())
+	}
+
+	return nil
+}
+
+func (e *encoder) instructions(ins code.Instructions, lines code.LineTable) {
+	e.uint32(len(ins))
+	e.buf.Write(ins)
+
+	e.uint32(len(lines))
+	for _, entry := range lines {
+		e.uint32(entry.Offset)
+		e.uint32(entry.Line)
+	}
+}
+
+// Decode reads a bytecode file written by Encode. The instructions are
+// checked so that the VM can run them without reading outside of its stack,
+// the locals, the free variables or the constants
+func Decode(r io.Reader) (*Bytecode, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !IsBytecode(data) {
+		return nil, ErrNotBytecode
+	}
+	d := decoder{data: data[len(BytecodeMagic):]}
+	if version := d.uint16(); d.err != nil {
+		return nil, d.err
+	} else if version != BytecodeVersion {
+		return nil, &VersionError{Version: version}
+	}
+
+	if len(data) < len(BytecodeMagic)+2+4 {
+		return nil, corrupt("unexpected end of file")
+	}
+	body, checksum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != checksum {
+		return nil, corrupt("checksum mismatch")
+	}
+	d.data = body[len(BytecodeMagic)+2:]
+
+	b := &Bytecode{}
+	count := d.count(1)
+	for i := 0; i < count && d.err == nil; i++ {
+		b.Constants = append(b.Constants, d.constant())
+	}
+	b.Instructions, b.Lines = d.instructions()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.data) > 0 {
+		return nil, corrupt("%d unexpected bytes after the instructions", len(d.data))
+	}
+
+	if err := validate(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// decoder reads from data, keeping the first error met
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data) {
+		d.err = corrupt("unexpected end of file")
+		d.data = nil
+		return nil
+	}
+
+	b := d.data[:n]
+	d.data = d.data[n:]
+
+	return b
+}
+
+func (d *decoder) uint16() int {
+	if b := d.next(2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+
+	return 0
+}
+
+func (d *decoder) uint32() int {
+	if b := d.next(4); b != nil {
+		return int(binary.BigEndian.Uint32(b))
+	}
+
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+
+	return 0
+}
+
+// count reads the number of items of a list, each taking at least size
+// bytes, so that a damaged count cannot make the decoder allocate more
+// than the file holds
+func (d *decoder) count(size int) int {
+	n := d.uint32()
+	if d.err == nil && n > len(d.data)/size {
+		d.err = corrupt("count %d exceeds the size of the file", n)
+		return 0
+	}
+
+	return n
+}
+
+func (d *decoder) constant() object.Object {
+	tag := d.next(1)
+	if tag == nil {
+		return nil
+	}
+
+	switch tag[0] {
+	case tagInteger:
+		return &object.Integer{Value: int64(d.uint64())}
+	case tagFloat:
+		return &object.Float{Value: math.Float64frombits(d.uint64())}
+	case tagString:
+		return &object.String{Value: string(d.next(d.count(1)))}
+	case tagFunction:
+		fn := &object.CompiledFunction{NumLocals: d.uint16(), NumParameters: d.uint16()}
+		fn.Instructions, fn.Lines = d.instructions()
+		if d.err == nil && fn.NumParameters > fn.NumLocals {
+			d.err = corrupt("function with %d parameters and %d locals", fn.NumParameters, fn.NumLocals)
+		}
+		return fn
+	}
+
+	d.err = corrupt("unknown constant tag %q", tag[0])
+	return nil
+}
+
+func (d *decoder) instructions() (code.Instructions, code.LineTable) {
+	ins := code.Instructions(d.next(d.count(1)))
+
+	var lines code.LineTable
+	n := d.count(8)
+	for i := 0; i < n && d.err == nil; i++ {
+		lines = append(lines, code.LineEntry{Offset: d.uint32(), Line: d.uint32()})
+	}
+
+	return ins, lines
+}
@@ -0,0 +1,202 @@
+package compiler_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/code"
+	"github.com/rsb/monkey_interpreter/compiler"
+	"github.com/rsb/monkey_interpreter/object"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encode(t *testing.T, b *compiler.Bytecode) []byte {
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, b); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// resign recomputes the checksum of data after it was modified
+func resign(data []byte) []byte {
+	body := data[:len(data)-4]
+	binary.BigEndian.PutUint32(data[len(data)-4:], crc32.ChecksumIEEE(body))
+
+	return data
+}
+
+func TestEncodeDecode(t *testing.T) {
+	assert := assert.New(t)
+
+	bytecode, err := compile(t, `let pi = 3.14;
+let greet = fn(name) { "hello " + name };
+let add = fn(a) { fn(b) { a + b } };
+greet("monkey"); add(1)(-2)`)
+	if !assert.NoError(err) {
+		return
+	}
+
+	data := encode(t, bytecode)
+	assert.True(compiler.IsBytecode(data))
+	assert.Equal(compiler.BytecodeMagic, string(data[:4]))
+
+	decoded, err := compiler.Decode(bytes.NewReader(data))
+	if assert.NoError(err) {
+		assert.Equal(bytecode, decoded)
+	}
+}
+
+// TestDecodeCompiled checks that what the compiler produces is accepted
+func TestDecodeCompiled(t *testing.T) {
+	inputs := []string{
+		"if (true) { 1 } else { 2 }; if (false) { 3 }",
+		"let a = true && false || !true; [a, {1: 2, \"k\": [3]}[1]]",
+		"let f = fn(n) { if (n < 1) { return 0; } f(n - 1) }; f(3); return;",
+		"fn(a) { let g = fn() { fn() { a } }; let a = 1; g()() }(2)",
+		"let g = fn(x) { if (x) { let y = 1; } let h = fn() { y }; h }; g(false)()",
+	}
+
+	for _, input := range inputs {
+		bytecode, err := compile(t, input)
+		if !assert.NoError(t, err, input) {
+			continue
+		}
+
+		_, err = compiler.Decode(bytes.NewReader(encode(t, bytecode)))
+		assert.NoError(t, err, input)
+	}
+}
+
+func TestEncodeUnsupportedConstant(t *testing.T) {
+	b := &compiler.Bytecode{Constants: []object.Object{&object.Array{}}}
+
+	err := compiler.Encode(&bytes.Buffer{}, b)
+	assert.EqualError(t, err, "compiler: encoding constant 0: unsupported constant type ARRAY")
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid := &compiler.Bytecode{
+		Instructions: concat([]code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpPop),
+		}),
+		Lines:     code.LineTable{{Offset: 0, Line: 1}},
+		Constants: []object.Object{&object.Integer{Value: 1}},
+	}
+	data := encode(t, valid)
+
+	otherVersion := append([]byte{}, data...)
+	otherVersion[5] = compiler.BytecodeVersion + 1
+
+	flipped := append([]byte{}, data...)
+	flipped[len(flipped)-6] ^= 0xff
+
+	withBytecode := func(b *compiler.Bytecode) []byte { return encode(t, b) }
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", nil, "compiler: not a Monkey bytecode file"},
+		{"source", []byte("let x = 1;"), "compiler: not a Monkey bytecode file"},
+		{"version", otherVersion, "compiler: bytecode version 2 is not supported, want version 1"},
+		{"header only", []byte(compiler.BytecodeMagic + "\x00\x01"), "compiler: corrupt bytecode file: unexpected end of file"},
+		{"truncated", data[:len(data)-1], "compiler: corrupt bytecode file: checksum mismatch"},
+		{"flipped", flipped, "compiler: corrupt bytecode file: checksum mismatch"},
+		{"trailing", resign(append(append([]byte{}, data[:len(data)-4]...), 0, 0, 0, 0, 0)),
+			"compiler: corrupt bytecode file: 1 unexpected bytes after the instructions"},
+		{"count", resign(append(append([]byte{}, data[:6]...), 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0)),
+			"compiler: corrupt bytecode file: count 4294967295 exceeds the size of the file"},
+		{"opcode", withBytecode(&compiler.Bytecode{Instructions: code.Instructions{255}}),
+			"compiler: corrupt bytecode file: offset 0: opcode 255 undefined"},
+		{"operand", withBytecode(&compiler.Bytecode{Instructions: code.Instructions{byte(code.OpConstant), 0}}),
+			"compiler: corrupt bytecode file: offset 0: OpConstant is truncated"},
+		{"constant", withBytecode(&compiler.Bytecode{Instructions: code.Make(code.OpConstant, 1)}),
+			"compiler: corrupt bytecode file: offset 0: constant 1 out of range"},
+		{"closure", withBytecode(&compiler.Bytecode{Instructions: code.Make(code.OpClosure, 0, 0), Constants: valid.Constants}),
+			"compiler: corrupt bytecode file: offset 0: constant 0 is not a function"},
+		{"jump", withBytecode(&compiler.Bytecode{Instructions: code.Make(code.OpJump, 4)}),
+			"compiler: corrupt bytecode file: offset 0: jump to 4 out of range"},
+		{"function", withBytecode(&compiler.Bytecode{Constants: []object.Object{
+			&object.CompiledFunction{Instructions: code.Instructions{byte(code.OpGetFree)}},
+		}}), "compiler: corrupt bytecode file: constant 0: offset 0: OpGetFree is truncated"},
+		{"parameters", withBytecode(&compiler.Bytecode{Constants: []object.Object{
+			&object.CompiledFunction{NumParameters: 2},
+		}}), "compiler: corrupt bytecode file: function with 2 parameters and 0 locals"},
+		{"empty stack", withBytecode(&compiler.Bytecode{Instructions: code.Make(code.OpPop)}),
+			"compiler: corrupt bytecode file: offset 0: OpPop pops 1 values from a stack of 0"},
+		{"call", withBytecode(&compiler.Bytecode{Instructions: concat([]code.Instructions{
+			code.Make(code.OpNull),
+			code.Make(code.OpCall, 1),
+		})}), "compiler: corrupt bytecode file: offset 1: OpCall pops 2 values from a stack of 1"},
+		{"free in main", withBytecode(&compiler.Bytecode{Instructions: code.Make(code.OpGetFree, 3)}),
+			"compiler: corrupt bytecode file: offset 0: OpGetFree outside of a function"},
+		{"current closure in main", withBytecode(&compiler.Bytecode{Instructions: code.Make(code.OpCurrentClosure)}),
+			"compiler: corrupt bytecode file: offset 0: OpCurrentClosure outside of a function"},
+		{"return in main", withBytecode(&compiler.Bytecode{Instructions: code.Make(code.OpReturn)}),
+			"compiler: corrupt bytecode file: offset 0: OpReturn outside of a function"},
+		{"jump into an instruction", withBytecode(&compiler.Bytecode{Instructions: code.Make(code.OpJump, 1)}),
+			"compiler: corrupt bytecode file: offset 0: jump to 1 is not the start of an instruction"},
+		{"stack depth", withBytecode(&compiler.Bytecode{Instructions: concat([]code.Instructions{
+			code.Make(code.OpTrue),
+			code.Make(code.OpJumpNotTruthy, 7),
+			code.Make(code.OpNull),
+			code.Make(code.OpNull),
+			code.Make(code.OpPop),
+			code.Make(code.OpNull),
+		})}), "compiler: corrupt bytecode file: offset 7: stack of 1 values, another path leaves 0"},
+		{"hash", withBytecode(&compiler.Bytecode{Instructions: concat([]code.Instructions{
+			code.Make(code.OpNull),
+			code.Make(code.OpHash, 1),
+		})}), "compiler: corrupt bytecode file: offset 1: hash of 1 keys and values"},
+		{"main locals", withBytecode(&compiler.Bytecode{Instructions: code.Make(code.OpGetLocal, 0)}),
+			"compiler: corrupt bytecode file: offset 0: local 0 out of range"},
+		{"function locals", withBytecode(&compiler.Bytecode{Constants: []object.Object{
+			&object.CompiledFunction{NumLocals: 1, Instructions: concat([]code.Instructions{
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpReturnValue),
+			})},
+		}}), "compiler: corrupt bytecode file: constant 0: offset 0: local 1 out of range"},
+		{"cell locals", withBytecode(&compiler.Bytecode{Constants: []object.Object{
+			&object.CompiledFunction{Instructions: concat([]code.Instructions{
+				code.Make(code.OpCaptureCell, 0),
+				code.Make(code.OpReturnValue),
+			})},
+		}}), "compiler: corrupt bytecode file: constant 0: offset 0: local 0 out of range"},
+		{"no return", withBytecode(&compiler.Bytecode{Constants: []object.Object{
+			&object.CompiledFunction{Instructions: code.Make(code.OpNull)},
+		}}), "compiler: corrupt bytecode file: constant 0: end of function reached without a return"},
+		{"function stack", withBytecode(&compiler.Bytecode{Constants: []object.Object{
+			&object.CompiledFunction{Instructions: code.Make(code.OpReturnValue)},
+		}}), "compiler: corrupt bytecode file: constant 0: offset 0: OpReturnValue pops 1 values from a stack of 0"},
+		{"free variables", withBytecode(&compiler.Bytecode{
+			Instructions: concat([]code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpClosure, 0, 1),
+				code.Make(code.OpPop),
+			}),
+			Constants: []object.Object{
+				&object.CompiledFunction{Instructions: concat([]code.Instructions{
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpReturnValue),
+				})},
+			},
+		}), "compiler: corrupt bytecode file: offset 1: closure of constant 0 captures 1 free variables, the function uses 2"},
+	}
+
+	for _, tt := range tests {
+		_, err := compiler.Decode(bytes.NewReader(tt.data))
+		assert.EqualError(t, err, tt.expected, tt.name)
+	}
+
+	_, err := compiler.Decode(bytes.NewReader(otherVersion))
+	assert.IsType(t, &compiler.VersionError{}, err)
+	_, err = compiler.Decode(bytes.NewReader(flipped))
+	assert.IsType(t, &compiler.CorruptError{}, err)
+}
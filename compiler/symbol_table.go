@@ -0,0 +1,122 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+	// CellScope is a local kept in a cell because closures capture it
+	CellScope SymbolScope = "CELL"
+	// FreeCellScope is a free symbol capturing a cell
+	FreeCellScope SymbolScope = "FREE_CELL"
+)
+
+// Symbol is a name bound by a let statement or a parameter, with where the
+// virtual machine keeps its value
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable holds the names bound in a scope. The table of a function
+// body is enclosed by the table of the scope the function is defined in
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// captured are the names used by the functions nested in this scope,
+	// locals with these names are defined in cells
+	captured map[string]bool
+
+	// FreeSymbols are the symbols of outer function scopes used in this
+	// one, in the order the closure captures them
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define binds name in this scope. Binding a name again reuses its slot,
+// like a let statement replaces the value in the evaluator's environment
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope || symbol.Scope == CellScope) {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: GlobalScope}
+	if s.Outer != nil {
+		symbol.Scope = LocalScope
+		if s.captured[name] {
+			symbol.Scope = CellScope
+		}
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+
+	return symbol
+}
+
+// DefineParameter binds name to a new slot even if a previous parameter has
+// the same name, since each argument of a call fills its own slot. The last
+// of them hides the others, like in the evaluator's environment
+func (s *SymbolTable) DefineParameter(name string) Symbol {
+	delete(s.store, name)
+
+	return s.Define(name)
+}
+
+// DefineFunctionName binds name to the function being compiled in this
+// scope, so it can call itself
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+
+	return symbol
+}
+
+// NumDefinitions returns the number of slots needed by the names bound in
+// this scope
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
+
+// Resolve looks name up in this scope and the enclosing ones. A local of
+// an enclosing function is turned into a free symbol of this one
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || symbol.Scope == GlobalScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	if original.Scope == CellScope || original.Scope == FreeCellScope {
+		symbol.Scope = FreeCellScope
+	}
+	s.store[original.Name] = symbol
+
+	return symbol
+}
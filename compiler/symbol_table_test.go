@@ -0,0 +1,91 @@
+package compiler_test
+
+import (
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/compiler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefineAndResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	global := compiler.NewSymbolTable()
+	a := global.Define("a")
+	b := global.Define("b")
+	assert.Equal(compiler.Symbol{Name: "a", Scope: compiler.GlobalScope, Index: 0}, a)
+	assert.Equal(compiler.Symbol{Name: "b", Scope: compiler.GlobalScope, Index: 1}, b)
+	assert.Equal(a, global.Define("a"), "rebinding reuses the slot")
+	assert.Equal(2, global.NumDefinitions())
+
+	local := compiler.NewEnclosedSymbolTable(global)
+	c := local.Define("c")
+	assert.Equal(compiler.Symbol{Name: "c", Scope: compiler.LocalScope, Index: 0}, c)
+
+	resolved, ok := local.Resolve("a")
+	assert.True(ok)
+	assert.Equal(a, resolved)
+
+	_, ok = local.Resolve("d")
+	assert.False(ok)
+}
+
+func TestDefineParameter(t *testing.T) {
+	assert := assert.New(t)
+
+	local := compiler.NewEnclosedSymbolTable(compiler.NewSymbolTable())
+	local.DefineParameter("a")
+	a := local.DefineParameter("a")
+	assert.Equal(compiler.Symbol{Name: "a", Scope: compiler.LocalScope, Index: 1}, a, "each parameter has its own slot")
+	assert.Equal(2, local.NumDefinitions())
+
+	resolved, ok := local.Resolve("a")
+	assert.True(ok)
+	assert.Equal(a, resolved, "the last parameter hides the first")
+}
+
+func TestResolveFree(t *testing.T) {
+	assert := assert.New(t)
+
+	global := compiler.NewSymbolTable()
+	global.Define("a")
+
+	first := compiler.NewEnclosedSymbolTable(global)
+	first.Define("b")
+
+	second := compiler.NewEnclosedSymbolTable(first)
+	second.Define("c")
+
+	tests := []struct {
+		name     string
+		expected compiler.Symbol
+	}{
+		{"a", compiler.Symbol{Name: "a", Scope: compiler.GlobalScope, Index: 0}},
+		{"b", compiler.Symbol{Name: "b", Scope: compiler.FreeScope, Index: 0}},
+		{"c", compiler.Symbol{Name: "c", Scope: compiler.LocalScope, Index: 0}},
+	}
+
+	for _, tt := range tests {
+		symbol, ok := second.Resolve(tt.name)
+		assert.True(ok, tt.name)
+		assert.Equal(tt.expected, symbol, tt.name)
+	}
+
+	assert.Equal([]compiler.Symbol{{Name: "b", Scope: compiler.LocalScope, Index: 0}}, second.FreeSymbols)
+}
+
+func TestDefineFunctionName(t *testing.T) {
+	assert := assert.New(t)
+
+	local := compiler.NewEnclosedSymbolTable(compiler.NewSymbolTable())
+	local.DefineFunctionName("f")
+
+	symbol, ok := local.Resolve("f")
+	assert.True(ok)
+	assert.Equal(compiler.Symbol{Name: "f", Scope: compiler.FunctionScope, Index: 0}, symbol)
+
+	// a parameter named like the function shadows it
+	param := local.Define("f")
+	assert.Equal(compiler.Symbol{Name: "f", Scope: compiler.LocalScope, Index: 0}, param)
+}
@@ -0,0 +1,240 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/rsb/monkey_interpreter/code"
+	"github.com/rsb/monkey_interpreter/object"
+)
+
+// validate checks the instructions of the main program and of the function
+// constants of b, which may come from a damaged or forged file. Every
+// instruction has to be complete, its operands have to refer to existing
+// constants, locals and free variables, jumps have to land on an
+// instruction, and on every path to an instruction the stack has to hold
+// the same number of values, enough for the values it pops. A function
+// must return rather than run past its last instruction
+func validate(b *Bytecode) *CorruptError {
+	// the number of free variables each function uses, every closure of
+	// the function has to capture at least as many
+	numFree := make(map[int]int)
+	starts := make(map[int]map[int]bool)
+	for i, constant := range b.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			fnStarts, err := decodeInstructions(fn.Instructions)
+			if err != nil {
+				return corrupt("constant %d: %s", i, err.Message)
+			}
+			starts[i] = fnStarts
+			numFree[i] = freeVariables(fn.Instructions)
+		}
+	}
+
+	for i, constant := range b.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			v := &verifier{constants: b.Constants, numFree: numFree, ins: fn.Instructions, starts: starts[i], function: true, numLocals: fn.NumLocals}
+			if err := v.verify(); err != nil {
+				return corrupt("constant %d: %s", i, err.Message)
+			}
+		}
+	}
+
+	mainStarts, err := decodeInstructions(b.Instructions)
+	if err != nil {
+		return err
+	}
+	v := &verifier{constants: b.Constants, numFree: numFree, ins: b.Instructions, starts: mainStarts}
+
+	return v.verify()
+}
+
+// decodeInstructions checks that every instruction of ins is defined and
+// complete, and returns the offsets they start at
+func decodeInstructions(ins code.Instructions) (map[int]bool, *CorruptError) {
+	starts := make(map[int]bool)
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return nil, corrupt("offset %d: %s", i, err)
+		}
+		if i+def.Width() > len(ins) {
+			return nil, corrupt("offset %d: %s is truncated", i, def.Name)
+		}
+
+		starts[i] = true
+		i += def.Width()
+	}
+
+	return starts, nil
+}
+
+// freeVariables returns the number of free variables the instructions of a
+// function read
+func freeVariables(ins code.Instructions) int {
+	n := 0
+	for i := 0; i < len(ins); {
+		def, _ := code.Lookup(ins[i])
+		if op := code.Opcode(ins[i]); op == code.OpGetFree || op == code.OpGetFreeCell {
+			if index := int(code.ReadUint8(ins[i+1:])); index >= n {
+				n = index + 1
+			}
+		}
+		i += def.Width()
+	}
+
+	return n
+}
+
+// verifier checks the instructions of the main program or of a function
+type verifier struct {
+	constants []object.Object
+	numFree   map[int]int
+
+	ins       code.Instructions
+	starts    map[int]bool
+	function  bool
+	numLocals int
+}
+
+func (v *verifier) verify() *CorruptError {
+	for i := 0; i < len(v.ins); {
+		if err := v.checkOperands(i); err != nil {
+			return err
+		}
+		_, def, _ := v.instruction(i)
+		i += def.Width()
+	}
+
+	return v.checkStack()
+}
+
+func (v *verifier) instruction(i int) (code.Opcode, *code.Definition, []int) {
+	def, _ := code.Lookup(v.ins[i])
+	operands, _ := code.ReadOperands(def, v.ins[i+1:])
+
+	return code.Opcode(v.ins[i]), def, operands
+}
+
+func (v *verifier) checkOperands(i int) *CorruptError {
+	op, def, operands := v.instruction(i)
+
+	switch op {
+	case code.OpConstant:
+		if operands[0] >= len(v.constants) {
+			return corrupt("offset %d: constant %d out of range", i, operands[0])
+		}
+	case code.OpClosure:
+		if operands[0] >= len(v.constants) {
+			return corrupt("offset %d: constant %d out of range", i, operands[0])
+		}
+		if _, ok := v.constants[operands[0]].(*object.CompiledFunction); !ok {
+			return corrupt("offset %d: constant %d is not a function", i, operands[0])
+		}
+		if want := v.numFree[operands[0]]; operands[1] < want {
+			return corrupt("offset %d: closure of constant %d captures %d free variables, the function uses %d", i, operands[0], operands[1], want)
+		}
+	case code.OpJump, code.OpJumpNotTruthy:
+		if operands[0] > len(v.ins) {
+			return corrupt("offset %d: jump to %d out of range", i, operands[0])
+		}
+		if operands[0] < len(v.ins) && !v.starts[operands[0]] {
+			return corrupt("offset %d: jump to %d is not the start of an instruction", i, operands[0])
+		}
+	case code.OpGetLocal, code.OpSetLocal, code.OpGetCell, code.OpSetCell, code.OpCaptureCell:
+		if operands[0] >= v.numLocals {
+			return corrupt("offset %d: local %d out of range", i, operands[0])
+		}
+	case code.OpGetFree, code.OpGetFreeCell, code.OpCurrentClosure, code.OpReturn:
+		if !v.function {
+			return corrupt("offset %d: %s outside of a function", i, def.Name)
+		}
+	case code.OpHash:
+		if operands[0]%2 != 0 {
+			return corrupt("offset %d: hash of %d keys and values", i, operands[0])
+		}
+	}
+
+	return nil
+}
+
+// checkStack follows every path through the instructions, counting the
+// values on the stack of the frame
+func (v *verifier) checkStack() *CorruptError {
+	depths := make(map[int]int, len(v.starts)+1)
+	depths[0] = 0
+	work := []int{0}
+
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		if i == len(v.ins) {
+			if v.function {
+				return corrupt("end of function reached without a return")
+			}
+			continue
+		}
+
+		op, def, operands := v.instruction(i)
+		pop, push := stackEffect(op, operands)
+		depth := depths[i]
+		if depth < pop {
+			return corrupt("offset %d: %s pops %d values from a stack of %d", i, def.Name, pop, depth)
+		}
+		depth += push - pop
+
+		var next []int
+		switch op {
+		case code.OpJump:
+			next = []int{operands[0]}
+		case code.OpJumpNotTruthy:
+			next = []int{i + def.Width(), operands[0]}
+		case code.OpReturnValue, code.OpReturn:
+		default:
+			next = []int{i + def.Width()}
+		}
+
+		for _, n := range next {
+			if known, ok := depths[n]; !ok {
+				depths[n] = depth
+				work = append(work, n)
+			} else if known != depth {
+				return corrupt("offset %d: stack of %d values, another path leaves %d", n, depth, known)
+			}
+		}
+	}
+
+	return nil
+}
+
+// stackEffect returns the number of values the instruction pops from the
+// stack and pushes on it
+func stackEffect(op code.Opcode, operands []int) (pop, push int) {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetFree, code.OpCurrentClosure,
+		code.OpGetCell, code.OpGetFreeCell, code.OpCaptureCell:
+		return 0, 1
+	case code.OpPop, code.OpSetGlobal, code.OpSetLocal, code.OpSetCell,
+		code.OpJumpNotTruthy, code.OpReturnValue:
+		return 1, 0
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+		code.OpEqual, code.OpNotEqual,
+		code.OpGreaterThan, code.OpGreaterEqual, code.OpLessThan, code.OpLessEqual,
+		code.OpIndex:
+		return 2, 1
+	case code.OpMinus, code.OpBang:
+		return 1, 1
+	case code.OpArray, code.OpHash:
+		return operands[0], 1
+	case code.OpCall:
+		// the function and its arguments, replaced by the result
+		return operands[0] + 1, 1
+	case code.OpClosure:
+		return operands[1], 1
+	case code.OpJump, code.OpReturn:
+		return 0, 0
+	}
+
+	panic(fmt.Sprintf("compiler: no stack effect for opcode %d", op))
+}
@@ -0,0 +1,527 @@
+package evaluator_test
+
+import (
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/evaluator"
+	"github.com/rsb/monkey_interpreter/lexer"
+	"github.com/rsb/monkey_interpreter/object"
+	"github.com/rsb/monkey_interpreter/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"3 * 3 * 3 + 10", 37},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"1 < 2 == 2 > 1", true},
+		{"1 < 2 != 2 > 1", false},
+		{"1 < 2 == 2 < 1", false},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"(1 > 2) == true", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!5", false},
+		{"!!5", true},
+		{"!-5", false},
+		{"let b = 1 < 2; !b", false},
+		{"let b = 1 < 2; !!b", true},
+		{"!true", false},
+		{"!false", true},
+		{"!!true", true},
+		{"!(1 < 2)", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLetStatementProducesNull(t *testing.T) {
+	evaluated := testEval(t, "let a = 5;")
+	testNullObject(t, evaluated)
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let b = 1 < 2; 5 + b;", "type mismatch: INTEGER + BOOLEAN"},
+		{"let b = 1 < 2; 5 + b; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"let b = 1 < 2; -b", "unknown operator: -BOOLEAN"},
+		{"let b = 1 < 2; b + b;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"let b = 1 < 2; 5; b + b; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { if (10 > 1) { return true + false; } return 1; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (foo) { 1 }", "identifier not found: foo"},
+		{"let f = fn(x) { x }; f(1, 2)", "wrong number of arguments: want=1, got=2"},
+		{"let a = 5; a(1)", "not a function: INTEGER"},
+		{"let f = fn(x) { x }; f(y)", "identifier not found: y"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`"Hello" + 1`, "type mismatch: STRING + INTEGER"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{`1[0]`, "index operator not supported: INTEGER[INTEGER]"},
+		{`[1, 2][true]`, "index operator not supported: ARRAY[BOOLEAN]"},
+		{"10 / 0", "division by zero: 10 / 0"},
+		{"let a = 10 / 0; a", "division by zero: 10 / 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testErrorObject(t, evaluated, tt.expectedMessage)
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"let a = 3; return a * a; a", 9},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+		{"if (10 > 1) { return 10; } 1", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBareReturnStatement(t *testing.T) {
+	evaluated := testEval(t, "return; 9;")
+	testNullObject(t, evaluated)
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 < 2) { }", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	assert := assert.New(t)
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(t, input)
+	fn, ok := evaluated.(*object.Function)
+	if !assert.True(ok, "object is not *object.Function, got=%T (%+v)", evaluated, evaluated) {
+		return
+	}
+
+	assert.Len(fn.Parameters, 1)
+	assert.Equal("x", fn.Parameters[0].String())
+	assert.Equal("(x + 2)", fn.Body.String())
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let twice = fn(f, x) { f(f(x)) }; twice(fn(y) { y * 2 }, 3)", 12},
+		{"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10)", 55},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+	let newAdder = fn(x) {
+		fn(y) { x + y };
+	};
+
+	let addTwo = newAdder(2);
+	addTwo(2);`
+
+	testIntegerObject(t, testEval(t, input), 4)
+}
+
+func TestStringLiteral(t *testing.T) {
+	assert := assert.New(t)
+
+	evaluated := testEval(t, `"Hello\tWorld!"`)
+	str, ok := evaluated.(*object.String)
+	if assert.True(ok, "object is not *object.String, got=%T (%+v)", evaluated, evaluated) {
+		assert.Equal("Hello\tWorld!", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	assert := assert.New(t)
+
+	evaluated := testEval(t, `let greet = fn(name) { "Hello" + " " + name + "!" }; greet("World")`)
+	str, ok := evaluated.(*object.String)
+	if assert.True(ok, "object is not *object.String, got=%T (%+v)", evaluated, evaluated) {
+		assert.Equal("Hello World!", str.Value)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" + "b" == "ab"`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	assert := assert.New(t)
+
+	evaluated := testEval(t, "[1, 2 * 2, 3 + 3]")
+	result, ok := evaluated.(*object.Array)
+	if !assert.True(ok, "object is not *object.Array, got=%T (%+v)", evaluated, evaluated) {
+		return
+	}
+
+	assert.Len(result.Elements, 3)
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+	assert.Equal("[1, 4, 6]", result.Inspect())
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	assert := assert.New(t)
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Hash)
+	if !assert.True(ok, "object is not *object.Hash, got=%T (%+v)", evaluated, evaluated) {
+		return
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		evaluator.TRUE.HashKey():                   5,
+		evaluator.FALSE.HashKey():                  6,
+	}
+
+	assert.Len(result.Pairs, len(expected))
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if assert.True(ok, "no pair for given key in Pairs") {
+			testIntegerObject(t, pair.Value, expectedValue)
+		}
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestStringHashKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	hello1 := &object.String{Value: "Hello World"}
+	hello2 := &object.String{Value: "Hello World"}
+	diff := &object.String{Value: "My name is johnny"}
+
+	assert.Equal(hello1.HashKey(), hello2.HashKey())
+	assert.NotEqual(hello1.HashKey(), diff.HashKey())
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"1e3 - 1", 999.0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		result, ok := evaluated.(*object.Float)
+		if assert.True(t, ok, "object is not *object.Float, got=%T (%+v)", evaluated, evaluated) {
+			assert.Equal(t, tt.expected, result.Value)
+		}
+	}
+}
+
+func TestEvalFloatComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"2.0 == 2", true},
+		{"0.1 + 0.2 != 0.3", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("3.0", testEval(t, "1.5 * 2").Inspect())
+	assert.Equal("0.25", testEval(t, "1 / 4.0").Inspect())
+	assert.Equal("1e+21", testEval(t, "1e21").Inspect())
+	testErrorObject(t, testEval(t, "1.5 / 0"), "division by zero: 1.5 / 0")
+}
+
+func TestEvalComparisonAndModulo(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"7 % 3", 7 % 3},
+		{"-7 % 3", -7 % 3},
+		{"10 % 5 == 0", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"1.5 <= 1", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+
+	result, ok := testEval(t, "7.5 % 2").(*object.Float)
+	if assert.True(t, ok) {
+		assert.Equal(t, 1.5, result.Value)
+	}
+	testErrorObject(t, testEval(t, "7 % 0"), "division by zero: 7 % 0")
+}
+
+func TestEvalLogicalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 0", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"let x = 5; x > 0 && x % 2 == 1", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestLogicalExpressionsShortCircuit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"false && undefined", false},
+		{"true || undefined", true},
+		{"let boom = fn() { 1 / 0 }; false && boom()", false},
+		{"let boom = fn() { 1 / 0 }; true || boom()", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval(t, "true && undefined"), "identifier not found: undefined")
+	testErrorObject(t, testEval(t, "false || undefined"), "identifier not found: undefined")
+}
+
+func TestEvalMalformedNodes(t *testing.T) {
+	l := lexer.New("let x = 1 + ;")
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	evaluated := evaluator.Eval(program, object.NewEnvironment())
+	testErrorObject(t, evaluated, "cannot evaluate malformed expression at 1:13")
+}
@@ -0,0 +1,62 @@
+package evaluator_test
+
+import (
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/evaluator"
+	"github.com/rsb/monkey_interpreter/lexer"
+	"github.com/rsb/monkey_interpreter/object"
+	"github.com/rsb/monkey_interpreter/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func testEval(t *testing.T, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	env := object.NewEnvironment()
+	return evaluator.Eval(program, env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) {
+	result, ok := obj.(*object.Integer)
+	if !assert.True(t, ok, "object is not *object.Integer, got=%T (%+v)", obj, obj) {
+		return
+	}
+	assert.Equal(t, expected, result.Value)
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) {
+	result, ok := obj.(*object.Boolean)
+	if !assert.True(t, ok, "object is not *object.Boolean, got=%T (%+v)", obj, obj) {
+		return
+	}
+	assert.Equal(t, expected, result.Value)
+}
+
+func testNullObject(t *testing.T, obj object.Object) {
+	assert.Equal(t, evaluator.NULL, obj, "object is not NULL, got=%T (%+v)", obj, obj)
+}
+
+func testErrorObject(t *testing.T, obj object.Object, expected string) {
+	errObj, ok := obj.(*object.Error)
+	if !assert.True(t, ok, "object is not *object.Error, got=%T (%+v)", obj, obj) {
+		return
+	}
+	assert.Equal(t, expected, errObj.Message)
+}
+
+func checkParserErrors(t *testing.T, p *parser.Parser) {
+	errs := p.Errors()
+	if len(errs) == 0 {
+		return
+	}
+
+	for _, msg := range errs {
+		t.Errorf("parser error: %q", msg)
+	}
+
+	t.FailNow()
+}
@@ -0,0 +1,80 @@
+// Package format implements the canonical formatting of Monkey source.
+//
+// Statements are printed one per line and blocks are indented with tabs.
+// Parentheses are only kept where the parser's precedences require them.
+// Comments are kept close to the statement they were attached to in the
+// source, and single blank lines between statements are preserved
+package format
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/lexer"
+	"github.com/rsb/monkey_interpreter/parser"
+	"github.com/rsb/monkey_interpreter/token"
+)
+
+// Source formats src in canonical style and returns the result. If src
+// does not parse, the first error reported by the parser is returned
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	for _, err := range p.Diagnostics() {
+		if err.Severity == parser.SeverityError {
+			return nil, err
+		}
+	}
+
+	pr := printer{comments: scanComments(src)}
+	pr.program(program)
+
+	return pr.buf.Bytes(), nil
+}
+
+// Node writes the canonical form of node to w. Node has no access to the
+// source, so comments are not printed
+func Node(w io.Writer, node ast.Node) error {
+	var pr printer
+	switch node := node.(type) {
+	case *ast.Program:
+		pr.program(node)
+	case ast.Statement:
+		pr.statement(node, nil, false)
+	case ast.Expression:
+		pr.expr(node, parser.LOWEST)
+	}
+
+	_, err := w.Write(pr.buf.Bytes())
+
+	return err
+}
+
+// scanComments returns every comment of src in source order
+func scanComments(src []byte) []token.Comment {
+	var comments []token.Comment
+
+	l := lexer.NewWithMode(string(src), lexer.ScanComments)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.COMMENT {
+			comments = append(comments, token.Comment{Text: tok.Literal, Pos: tok.Pos, End: tok.End})
+		}
+	}
+
+	return comments
+}
+
+// isLineComment reports whether c runs to the end of its line, as // and
+// #! comments do
+func isLineComment(c token.Comment) bool {
+	return len(c.Text) > 1 && (c.Text[1] == '/' || c.Text[1] == '!')
+}
+
+// String returns the canonical form of n, without comments
+func String(n ast.Node) string {
+	var buf bytes.Buffer
+	_ = Node(&buf, n)
+
+	return buf.String()
+}
@@ -0,0 +1,188 @@
+package format_test
+
+import (
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/format"
+	"github.com/rsb/monkey_interpreter/lexer"
+	"github.com/rsb/monkey_interpreter/parser"
+	"github.com/rsb/monkey_interpreter/token"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let   x=5", "let x = 5;\n"},
+		{"return", "return;\n"},
+		{"return x", "return x;\n"},
+		{"a+b*c", "a + b * c;\n"},
+		{"(a+b)*c", "(a + b) * c;\n"},
+		{"a-(b-c)", "a - (b - c);\n"},
+		{"(a-b)-c", "a - b - c;\n"},
+		{"((a))", "a;\n"},
+		{"-(a+b)", "-(a + b);\n"},
+		{"-(-a)", "-(-a);\n"},
+		{"-(-(-a))", "-(-(-a));\n"},
+		{"-!-a", "-!-a;\n"},
+		{"(-a)[0]", "(-a)[0];\n"},
+		{"-a[0]", "-a[0];\n"},
+		{"f(x)[0](y)", "f(x)[0](y);\n"},
+		{"(a+b)(c)", "(a + b)(c);\n"},
+		{"a || b && c", "a || b && c;\n"},
+		{"(a || b) && c", "(a || b) && c;\n"},
+		{"a < b == (c >= d)", "a < b == c >= d;\n"},
+		{"(a == b) == c", "a == b == c;\n"},
+		{"a == (b == c)", "a == (b == c);\n"},
+		{`"a\"b\\c\nd\te"`, "\"a\\\"b\\\\c\\nd\\te\";\n"},
+		{"0x1F + 1_000 + 1.5e3", "0x1F + 1_000 + 1.5e3;\n"},
+		{"[1,2,[3]]", "[1, 2, [3]];\n"},
+		{"{1:2,\"a\":[]}", "{1: 2, \"a\": []};\n"},
+		{"{}", "{};\n"},
+		{"fn(){}", "fn() {};\n"},
+		{"fn(a,b){a+b}", "fn(a, b) { a + b };\n"},
+		{"fn(a,b){a+b;}", "fn(a, b) { a + b };\n"},
+		{"fn(x){ let y = x; y }", "fn(x) {\n\tlet y = x;\n\ty\n};\n"},
+		{"if(x){1}else{2}", "if (x) { 1 } else { 2 }\n"},
+		{"if (x) {\n1 }", "if (x) {\n\t1\n}\n"},
+		{"if (x) { 1 }; -1", "if (x) { 1 };\n-1;\n"},
+		{"if (x) { 1 } let y = 2", "if (x) { 1 }\nlet y = 2;\n"},
+		{"if (x) { 1 }; [1][0]", "if (x) { 1 };\n[1][0];\n"},
+		{"if (x) { 1 }; f(1)", "if (x) { 1 }\nf(1);\n"},
+		{"let a = 1;\n\n\n\nlet b = 2;", "let a = 1;\n\nlet b = 2;\n"},
+		{"let f = fn() {\n\n  let a = 1;\n\n  a\n\n};", "let f = fn() {\n\tlet a = 1;\n\n\ta\n};\n"},
+		{"let h = {\n\"a\": 1,\n  \"b\": 2}", "let h = {\n\t\"a\": 1,\n\t\"b\": 2\n};\n"},
+		{"let a = [\n1,\n2]", "let a = [\n\t1,\n\t2\n];\n"},
+	}
+
+	for _, tt := range tests {
+		out, err := format.Source([]byte(tt.input))
+		if !assert.NoError(t, err, tt.input) {
+			continue
+		}
+		assert.Equal(t, tt.expected, string(out), tt.input)
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// leading\nlet x = 1; // trailing", "// leading\nlet x = 1; // trailing\n"},
+		{"let x = 1;\n\n// alone\n\nlet y = 2;", "let x = 1;\n\n// alone\n\nlet y = 2;\n"},
+		{"let x = 1 + /* two */ 2;", "let x = 1 + 2; /* two */\n"},
+		{"let x = f(1, // one\n2, // two\n3);", "let x = f(1, 2, 3); // one\n// two\n"},
+		{"fn() { /* empty */ }", "fn() {\n\t/* empty */\n};\n"},
+		{"fn(x) { x // id\n}", "fn(x) {\n\tx // id\n};\n"},
+		{"let f = fn(x) {\n  // first\n  x\n  // last\n};", "let f = fn(x) {\n\t// first\n\tx\n\t// last\n};\n"},
+		{"let h = {\n  // a\n  \"a\": 1, // one\n  \"b\": 2\n  // end\n};", "let h = {\n\t// a\n\t\"a\": 1, // one\n\t\"b\": 2\n\t// end\n};\n"},
+		{"x\n/* a\n   b */", "x;\n/* a\n   b */\n"},
+		{"#!/usr/bin/env monkey\nx", "#!/usr/bin/env monkey\nx;\n"},
+	}
+
+	for _, tt := range tests {
+		out, err := format.Source([]byte(tt.input))
+		if !assert.NoError(t, err, tt.input) {
+			continue
+		}
+		assert.Equal(t, tt.expected, string(out), tt.input)
+	}
+}
+
+// corpus exercises every construct of the language, formatted or not
+var corpus = []string{
+	"let five = 5; let ten = 10; let add = fn(x, y) { x + y; }; let result = add(five, ten);",
+	"!-a / 5 * 5; 5 < 10 > 5; if (5 < 10) { return true; } else { return false; } 10 == 10; 10 != 9;",
+	`let s = "hello \u{1F600}\u{7}"; let a = [1, 2 * 2, 3 + 3]; a[1 + 1]; {"one": 1, true: 2, 3: 3}["one"]`,
+	"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10)",
+	"a + b * c + d / e - f; 3 + 4 * 5 == 3 * 1 + 4 * 5; -(5 + 5); !(true == true); a * [1, 2, 3, 4][b * c] * d",
+	"add(a + b + c * d / f + g); add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8)); fn(x) { x }(5)(6)",
+	"1 <= 2 && 3 >= 4 || 5 % 2 == 1; !(a || b) && -c % 2",
+	"if (x) { 1 }\nif (y) { 2 }\n-3\n[4][0]\n(5)",
+	"let m = {\n  \"k\": fn(x) {\n    // double\n    x * 2\n  }, // fn\n  \"v\": [\n    1, // one\n    2\n  ]\n};\n\n\n// done\nm[\"k\"](m[\"v\"][0])",
+	"let f = fn() {};\nlet g = fn() { return; };\nlet h = fn() {\n\n};\nif (true) {} else { }\n",
+	"let n = 1.5 + 0.5 + 1e3 + 0o17 + 0b1010 + 0xFF;",
+	"/* header */ let a = 1; /* inline */ let b = 2;\n// footer",
+}
+
+func parse(t *testing.T, src string) *ast.Program {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	for _, msg := range p.Errors() {
+		t.Fatalf("parser error in %q: %s", src, msg)
+	}
+
+	return program
+}
+
+func comments(src string) []string {
+	var texts []string
+	l := lexer.NewWithMode(src, lexer.ScanComments)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.COMMENT {
+			texts = append(texts, tok.Literal)
+		}
+	}
+
+	return texts
+}
+
+func TestSourceIdempotent(t *testing.T) {
+	for _, src := range corpus {
+		once, err := format.Source([]byte(src))
+		if !assert.NoError(t, err, src) {
+			continue
+		}
+
+		twice, err := format.Source(once)
+		if !assert.NoError(t, err, string(once)) {
+			continue
+		}
+		assert.Equal(t, string(once), string(twice), "formatting %q is not idempotent", src)
+	}
+}
+
+func TestSourcePreservesMeaning(t *testing.T) {
+	for _, src := range corpus {
+		out, err := format.Source([]byte(src))
+		if !assert.NoError(t, err, src) {
+			continue
+		}
+
+		assert.Equal(t, parse(t, src).String(), parse(t, string(out)).String(), "formatting changed the meaning of %q", src)
+		assert.Equal(t, comments(src), comments(string(out)), "formatting lost comments of %q", src)
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	_, err := format.Source([]byte("let = 5;"))
+	if assert.Error(t, err) {
+		assert.Equal(t, "1:5: error: expected next token to be IDENT, got = instead", err.Error())
+	}
+}
+
+func TestNodeSynthesized(t *testing.T) {
+	// nodes built without tokens, as a rewrite would, still print valid
+	// source
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ExpressionStatment{Expression: &ast.InfixExpression{
+			Operator: "*",
+			Left: &ast.InfixExpression{
+				Operator: "+",
+				Left:     &ast.IntegerLiteral{Value: -1},
+				Right:    &ast.FloatLiteral{Value: 2},
+			},
+			Right: &ast.IndexExpression{
+				Left:  &ast.IntegerLiteral{Value: -3},
+				Index: &ast.Identifier{Value: "i"},
+			},
+		}},
+	}}
+
+	assert.Equal(t, "(-1 + 2.0) * (-3)[i];\n", format.String(program))
+}
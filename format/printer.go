@@ -0,0 +1,522 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/parser"
+	"github.com/rsb/monkey_interpreter/token"
+)
+
+// primary is the precedence of expressions that never need parentheses
+const primary = parser.INDEX + 1
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+
+	// comments holds every comment of the source, next is the first one not
+	// printed yet
+	comments []token.Comment
+	next     int
+
+	// line is the source line of the last thing printed on its own line,
+	// zero at the start of a block where blank lines are dropped
+	line int
+}
+
+func (p *printer) print(args ...string) {
+	for _, s := range args {
+		p.buf.WriteString(s)
+	}
+}
+
+func (p *printer) newline() {
+	p.buf.WriteByte('\n')
+}
+
+func (p *printer) writeIndent() {
+	for i := 0; i < p.indent; i++ {
+		p.buf.WriteByte('\t')
+	}
+}
+
+// separate starts a new line for something found on source line, keeping a
+// single blank line if the source had any
+func (p *printer) separate(line int) {
+	if line <= 0 {
+		return
+	}
+	if p.line > 0 && line > p.line+1 {
+		p.newline()
+	}
+	p.line = line
+}
+
+// commentsBefore prints every pending comment starting before pos on its
+// own line
+func (p *printer) commentsBefore(pos token.Position) {
+	if !pos.IsValid() {
+		return
+	}
+
+	for p.next < len(p.comments) && p.comments[p.next].Pos.Offset < pos.Offset {
+		c := p.comments[p.next]
+		p.separate(c.Pos.Line)
+		p.writeIndent()
+		p.print(c.Text)
+		p.newline()
+		p.line = c.End.Line
+		p.next++
+	}
+}
+
+// trailingComments prints the pending comments found inside the node ending
+// at end or on the same line after it. A line comment ends the line, any
+// further comment is moved to a line of its own
+func (p *printer) trailingComments(end token.Position) {
+	if !end.IsValid() {
+		return
+	}
+
+	lineComment := false
+	for p.next < len(p.comments) {
+		c := p.comments[p.next]
+		if c.Pos.Offset >= end.Offset && c.Pos.Line != end.Line {
+			break
+		}
+
+		if lineComment {
+			p.newline()
+			p.writeIndent()
+		} else {
+			p.print(" ")
+		}
+		p.print(c.Text)
+		lineComment = isLineComment(c)
+		p.line = c.End.Line
+		p.next++
+	}
+}
+
+// hasCommentsIn reports whether a pending comment starts between from and
+// to
+func (p *printer) hasCommentsIn(from, to token.Position) bool {
+	if !from.IsValid() || !to.IsValid() {
+		return false
+	}
+
+	for _, c := range p.comments[p.next:] {
+		if c.Pos.Offset >= to.Offset {
+			break
+		}
+		if c.Pos.Offset > from.Offset {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.statementList(program.Statements, false)
+
+	// comments at the end of the file
+	for p.next < len(p.comments) {
+		c := p.comments[p.next]
+		p.separate(c.Pos.Line)
+		p.print(c.Text)
+		p.newline()
+		p.line = c.End.Line
+		p.next++
+	}
+}
+
+// statementList prints every statement on lines of its own. In a block the
+// last expression statement is the block's value and is printed without a
+// semicolon
+func (p *printer) statementList(stmts []ast.Statement, block bool) {
+	for i, s := range stmts {
+		var next ast.Statement
+		if i+1 < len(stmts) {
+			next = stmts[i+1]
+		}
+
+		p.commentsBefore(s.Pos())
+		p.separate(s.Pos().Line)
+		p.writeIndent()
+		p.statement(s, next, block && next == nil)
+		p.trailingComments(s.End())
+		p.newline()
+		if end := s.End(); end.IsValid() {
+			p.line = end.Line
+		}
+	}
+}
+
+// statement prints s. next is the statement following s, if any, and last
+// is set for the value of a block
+func (p *printer) statement(s ast.Statement, next ast.Statement, last bool) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.print("let ", s.Name.Value, " = ")
+		p.expr(s.Value, parser.LOWEST)
+		p.print(";")
+	case *ast.ReturnStatement:
+		p.print("return")
+		if s.Value != nil {
+			p.print(" ")
+			p.expr(s.Value, parser.LOWEST)
+		}
+		p.print(";")
+	case *ast.BlockStatement:
+		p.block(s)
+	case *ast.ExpressionStatment:
+		p.expr(s.Expression, parser.LOWEST)
+		if !last && needsSemicolon(s, next) {
+			p.print(";")
+		}
+	default:
+		panic(fmt.Sprintf("format: unexpected statement %T", s))
+	}
+}
+
+// needsSemicolon reports whether the expression statement s must be
+// terminated. An if expression is only terminated when the next statement
+// would otherwise continue it, every other expression always is
+func needsSemicolon(s *ast.ExpressionStatment, next ast.Statement) bool {
+	if _, ok := s.Expression.(*ast.IfExpression); !ok {
+		return true
+	}
+
+	es, ok := next.(*ast.ExpressionStatment)
+
+	return ok && startsWithOperator(es.Expression)
+}
+
+// startsWithOperator reports whether the printed form of e starts with a
+// token that could continue the preceding expression
+func startsWithOperator(e ast.Expression) bool {
+	for {
+		var left ast.Expression
+		var ctx int
+
+		switch n := e.(type) {
+		case *ast.InfixExpression:
+			left, ctx = n.Left, precedence(n)
+		case *ast.LogicalExpression:
+			left, ctx = n.Left, precedence(n)
+		case *ast.CallExpression:
+			left, ctx = n.Function, parser.CALL
+		case *ast.IndexExpression:
+			left, ctx = n.Left, parser.CALL
+		case *ast.PrefixExpression:
+			return n.Operator == "-"
+		case *ast.ArrayLiteral:
+			return true
+		default:
+			return precedence(e) == parser.PREFIX // a negative literal
+		}
+
+		if precedence(left) < ctx {
+			return true // printed in parentheses
+		}
+		e = left
+	}
+}
+
+// startsWithMinus reports whether e is printed starting with a minus sign,
+// being a negation or a negative literal, when it is the operand of a
+// prefix operator
+func startsWithMinus(e ast.Expression) bool {
+	if prefix, ok := e.(*ast.PrefixExpression); ok {
+		return prefix.Operator == "-"
+	}
+
+	return precedence(e) == parser.PREFIX
+}
+
+// precedence returns the binding power of the operator at the root of e
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return operatorPrecedence(e.Token, e.Operator)
+	case *ast.LogicalExpression:
+		return operatorPrecedence(e.Token, e.Operator)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression:
+		return parser.INDEX
+	case *ast.IntegerLiteral:
+		// only built by rewriting a tree, the lexer has no negative literals
+		if e.Value < 0 {
+			return parser.PREFIX // printed with a minus sign
+		}
+	case *ast.FloatLiteral:
+		if e.Value < 0 {
+			return parser.PREFIX
+		}
+	}
+
+	return primary
+}
+
+// operatorPrecedence looks the operator up by its token, falling back to
+// the operator text for nodes built without one
+func operatorPrecedence(tok token.Token, operator string) int {
+	if tok.Type != "" {
+		return parser.Precedence(tok.Type)
+	}
+
+	return parser.Precedence(token.TokenType(operator))
+}
+
+// expr prints e, in parentheses if it binds looser than ctx
+func (p *printer) expr(e ast.Expression, ctx int) {
+	if precedence(e) < ctx {
+		p.print("(")
+		p.expr(e, parser.LOWEST)
+		p.print(")")
+		return
+	}
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.print(e.Value)
+	case *ast.IntegerLiteral:
+		if e.Token.Literal != "" {
+			p.print(e.Token.Literal)
+		} else {
+			p.print(strconv.FormatInt(e.Value, 10))
+		}
+	case *ast.FloatLiteral:
+		if e.Token.Literal != "" {
+			p.print(e.Token.Literal)
+		} else {
+			p.print(formatFloat(e.Value))
+		}
+	case *ast.StringLiteral:
+		p.print(quote(e.Value))
+	case *ast.Boolean:
+		p.print(strconv.FormatBool(e.Value))
+	case *ast.PrefixExpression:
+		p.print(e.Operator)
+		if e.Operator == "-" && startsWithMinus(e.Right) {
+			// --a would read like a decrement
+			p.print("(")
+			p.expr(e.Right, parser.LOWEST)
+			p.print(")")
+		} else {
+			p.expr(e.Right, parser.PREFIX)
+		}
+	case *ast.InfixExpression:
+		prec := precedence(e)
+		p.expr(e.Left, prec)
+		p.print(" ", e.Operator, " ")
+		p.expr(e.Right, prec+1)
+	case *ast.LogicalExpression:
+		prec := precedence(e)
+		p.expr(e.Left, prec)
+		p.print(" ", e.Operator, " ")
+		p.expr(e.Right, prec+1)
+	case *ast.IfExpression:
+		p.print("if (")
+		p.expr(e.Condition, parser.LOWEST)
+		p.print(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.print(" else ")
+			p.block(e.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.print("fn(")
+		for i, param := range e.Parameters {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.print(param.Value)
+		}
+		p.print(") ")
+		p.block(e.Body)
+	case *ast.CallExpression:
+		p.expr(e.Function, parser.CALL)
+		p.print("(")
+		p.exprList(e.Arguments)
+		p.print(")")
+	case *ast.IndexExpression:
+		p.expr(e.Left, parser.CALL)
+		p.print("[")
+		p.expr(e.Index, parser.LOWEST)
+		p.print("]")
+	case *ast.ArrayLiteral:
+		p.arrayLiteral(e)
+	case *ast.HashLiteral:
+		p.hashLiteral(e)
+	default:
+		panic(fmt.Sprintf("format: unexpected expression %T", e))
+	}
+}
+
+func (p *printer) exprList(list []ast.Expression) {
+	for i, e := range list {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.expr(e, parser.LOWEST)
+	}
+}
+
+// multiline reports whether a bracketed node spanned several source lines
+func multiline(open, close token.Token) bool {
+	return open.Pos.IsValid() && close.Pos.IsValid() && open.Pos.Line != close.Pos.Line
+}
+
+// block prints b on a single line if it was on one in the source, has at
+// most one statement and no comments. Otherwise every statement gets a line
+// of its own
+func (p *printer) block(b *ast.BlockStatement) {
+	comments := p.hasCommentsIn(b.Token.Pos, b.Rbrace.Pos)
+	if len(b.Statements) == 0 && !comments {
+		p.print("{}")
+		return
+	}
+
+	if len(b.Statements) == 1 && !multiline(b.Token, b.Rbrace) && b.Rbrace.Pos.IsValid() && !comments {
+		p.print("{ ")
+		p.statement(b.Statements[0], nil, true)
+		p.print(" }")
+		return
+	}
+
+	p.print("{")
+	p.newline()
+	p.indent++
+	p.line = 0
+	p.statementList(b.Statements, true)
+	p.commentsBefore(b.Rbrace.Pos)
+	p.indent--
+	p.writeIndent()
+	p.print("}")
+	if b.Rbrace.Pos.IsValid() {
+		p.line = b.Rbrace.Pos.Line
+	}
+}
+
+// arrayLiteral keeps an array written over several lines that way, one
+// element per line
+func (p *printer) arrayLiteral(a *ast.ArrayLiteral) {
+	if len(a.Elements) == 0 || !multiline(a.Token, a.Rbracket) {
+		p.print("[")
+		p.exprList(a.Elements)
+		p.print("]")
+		return
+	}
+
+	p.print("[")
+	p.newline()
+	p.indent++
+	p.line = 0
+	for i, e := range a.Elements {
+		p.element(e.Pos(), e.End(), i == len(a.Elements)-1, func() { p.expr(e, parser.LOWEST) })
+	}
+	p.commentsBefore(a.Rbracket.Pos)
+	p.indent--
+	p.writeIndent()
+	p.print("]")
+	p.line = a.Rbracket.Pos.Line
+}
+
+// hashLiteral keeps a hash written over several lines that way, one pair
+// per line
+func (p *printer) hashLiteral(h *ast.HashLiteral) {
+	pair := func(kv ast.HashPair) {
+		p.expr(kv.Key, parser.LOWEST)
+		p.print(": ")
+		p.expr(kv.Value, parser.LOWEST)
+	}
+
+	if len(h.Pairs) == 0 || !multiline(h.Token, h.Rbrace) {
+		p.print("{")
+		for i, kv := range h.Pairs {
+			if i > 0 {
+				p.print(", ")
+			}
+			pair(kv)
+		}
+		p.print("}")
+		return
+	}
+
+	p.print("{")
+	p.newline()
+	p.indent++
+	p.line = 0
+	for i, kv := range h.Pairs {
+		kv := kv
+		p.element(kv.Key.Pos(), kv.Value.End(), i == len(h.Pairs)-1, func() { pair(kv) })
+	}
+	p.commentsBefore(h.Rbrace.Pos)
+	p.indent--
+	p.writeIndent()
+	p.print("}")
+	p.line = h.Rbrace.Pos.Line
+}
+
+// element prints one line of a multi-line literal
+func (p *printer) element(pos, end token.Position, last bool, body func()) {
+	p.commentsBefore(pos)
+	p.separate(pos.Line)
+	p.writeIndent()
+	body()
+	if !last {
+		p.print(",")
+	}
+	p.trailingComments(end)
+	p.newline()
+	if end.IsValid() {
+		p.line = end.Line
+	}
+}
+
+// quote returns s as a Monkey string literal, using the escapes the lexer
+// understands
+func quote(s string) string {
+	var b strings.Builder
+
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&b, `\u{%x}`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// formatFloat prints v so that it lexes as a float again
+func formatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+
+	return s
+}
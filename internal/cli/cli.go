@@ -0,0 +1,511 @@
+// Package cli implements the monkey command, documented in cmd/monkey. It
+// is shared with the module's root package, kept so that go run . still
+// works
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/compiler"
+	"github.com/rsb/monkey_interpreter/evaluator"
+	"github.com/rsb/monkey_interpreter/format"
+	"github.com/rsb/monkey_interpreter/lexer"
+	"github.com/rsb/monkey_interpreter/object"
+	"github.com/rsb/monkey_interpreter/optimize"
+	"github.com/rsb/monkey_interpreter/parser"
+	"github.com/rsb/monkey_interpreter/repl"
+	"github.com/rsb/monkey_interpreter/token"
+	"github.com/rsb/monkey_interpreter/vm"
+)
+
+// exit statuses
+const (
+	exitOK      = 0
+	exitRuntime = 1
+	exitUsage   = 2
+	exitSyntax  = 3
+)
+
+const usage = `usage: monkey <command> [arguments]
+       monkey <file> [arguments]
+
+The commands are:
+  run [-O] [file] [arguments]   run a program
+  tokens [file]                 print the tokens of a program
+  ast [file]                    print the syntax tree of a program as JSON
+  fmt [-l] [-w] [file ...]      format programs
+  check [file ...]              report syntax errors
+  build [-O] [-o output] [file] compile a program to a bytecode file
+  disasm [-O] [file]            print the instructions of a program or bytecode file
+
+Without arguments the REPL is started. A missing file or - reads the
+standard input. -O optimizes the program first.
+`
+
+// cli holds the streams a command works with
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+var commands = map[string]func(c *cli, args []string) int{
+	"run":    (*cli).run,
+	"tokens": (*cli).tokens,
+	"ast":    (*cli).dumpAST,
+	"fmt":    (*cli).formatFiles,
+	"check":  (*cli).check,
+	"build":  (*cli).build,
+	"disasm": (*cli).disasm,
+}
+
+// Run executes the command line args, without the program name, and
+// returns the exit status
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	if len(args) == 0 {
+		greet(stdout)
+		repl.Start(stdin, stdout)
+		return exitOK
+	}
+
+	switch name := args[0]; {
+	case name == "help" || name == "-h" || name == "-help" || name == "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	case commands[name] != nil:
+		return commands[name](c, args[1:])
+	case strings.HasPrefix(name, "-") && name != "-":
+		return c.usageError("unknown flag %s", name)
+	default:
+		return c.run(args)
+	}
+}
+
+func greet(w io.Writer) {
+	name := "there"
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name = u.Username
+	}
+
+	fmt.Fprintf(w, "Hello %s! This is the Monkey programming language!\n", name)
+	fmt.Fprintf(w, "Feel free to type in commands\n")
+}
+
+func (c *cli) usageError(format string, a ...interface{}) int {
+	fmt.Fprintf(c.stderr, "monkey: "+format+"\n\n", a...)
+	fmt.Fprint(c.stderr, usage)
+
+	return exitUsage
+}
+
+// readSource returns the name and the content of the file at path, or of
+// the standard input if path is empty or -
+func (c *cli) readSource(path string) (string, string, error) {
+	if path == "" || path == "-" {
+		src, err := ioutil.ReadAll(c.stdin)
+		return "<stdin>", string(src), err
+	}
+
+	src, err := ioutil.ReadFile(path)
+
+	return path, string(src), err
+}
+
+// parse reads and parses the program at path. It reports the diagnostics
+// and returns a non-zero status if it could not be read or has syntax errors
+func (c *cli) parse(path string) (string, *ast.Program, int) {
+	filename, src, err := c.readSource(path)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %v\n", err)
+		return filename, nil, exitUsage
+	}
+
+	program, status := c.parseSource(filename, src)
+
+	return filename, program, status
+}
+
+func (c *cli) parseSource(filename, src string) (*ast.Program, int) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if diags := p.Diagnostics(); len(diags) > 0 {
+		parser.Render(c.stderr, filename, src, diags)
+		if hasErrors(diags) {
+			return program, exitSyntax
+		}
+	}
+
+	return program, exitOK
+}
+
+// newSymbolTable returns the globals of a compiled program, in which args
+// is defined first so the VM finds the arguments in the first global
+func newSymbolTable() *compiler.SymbolTable {
+	s := compiler.NewSymbolTable()
+	s.Define("args")
+
+	return s
+}
+
+// compile parses and compiles src, reporting the errors. When optimized is
+// set the program is optimized first and the changes made are returned
+func (c *cli) compile(filename, src string, optimized bool) (*compiler.Bytecode, []optimize.Change, int) {
+	program, status := c.parseSource(filename, src)
+	if status != exitOK {
+		return nil, nil, status
+	}
+
+	var changes []optimize.Change
+	if optimized {
+		_, changes = optimize.Optimize(program)
+	}
+
+	comp := compiler.NewWithState(newSymbolTable(), nil)
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintf(c.stderr, "%s:%v\n", filename, err)
+		return nil, nil, exitSyntax
+	}
+
+	return comp.Bytecode(), changes, exitOK
+}
+
+// load returns the bytecode of the program at path, which is either a
+// bytecode file or a program to compile like compile does. src is empty
+// for a bytecode file
+func (c *cli) load(path string, optimized bool) (filename, src string, b *compiler.Bytecode, changes []optimize.Change, status int) {
+	filename, src, err := c.readSource(path)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %v\n", err)
+		return filename, "", nil, nil, exitUsage
+	}
+
+	if !compiler.IsBytecode([]byte(src)) {
+		b, changes, status = c.compile(filename, src, optimized)
+		return filename, src, b, changes, status
+	}
+
+	b, err = compiler.Decode(strings.NewReader(src))
+	if err != nil {
+		fmt.Fprintf(c.stderr, "%s: %v\n", filename, err)
+		return filename, "", nil, nil, exitUsage
+	}
+
+	return filename, "", b, nil, exitOK
+}
+
+func hasErrors(diags []*parser.Error) bool {
+	for _, d := range diags {
+		if d.Severity == parser.SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// singleInput returns the file named by args, empty for the standard input
+func singleInput(args []string) (string, bool) {
+	switch len(args) {
+	case 0:
+		return "", true
+	case 1:
+		return args[0], true
+	}
+
+	return "", false
+}
+
+func (c *cli) run(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	optimized := flags.Bool("O", false, "optimize the program before running it")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	var path string
+	if args = flags.Args(); len(args) > 0 {
+		path, args = args[0], args[1:]
+	}
+
+	filename, src, err := c.readSource(path)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %v\n", err)
+		return exitUsage
+	}
+
+	elements := make([]object.Object, len(args))
+	for i, arg := range args {
+		elements[i] = &object.String{Value: arg}
+	}
+	argsArray := &object.Array{Elements: elements}
+
+	if compiler.IsBytecode([]byte(src)) {
+		return c.runBytecode(filename, src, argsArray)
+	}
+
+	program, status := c.parseSource(filename, src)
+	if status != exitOK {
+		return status
+	}
+	if *optimized {
+		optimize.Optimize(program)
+	}
+
+	env := object.NewEnvironment()
+	env.Set("args", argsArray)
+
+	switch result := evaluator.Eval(program, env).(type) {
+	case *object.Error:
+		fmt.Fprintf(c.stderr, "%s: error: %s\n", filename, result.Message)
+		return exitRuntime
+	default:
+		c.printResult(result)
+	}
+
+	return exitOK
+}
+
+func (c *cli) runBytecode(filename, src string, args *object.Array) int {
+	b, err := compiler.Decode(strings.NewReader(src))
+	if err != nil {
+		fmt.Fprintf(c.stderr, "%s: %v\n", filename, err)
+		return exitUsage
+	}
+
+	globals := make([]object.Object, vm.GlobalsSize)
+	globals[0] = args
+
+	machine := vm.NewWithGlobalsStore(b, globals)
+	if err := machine.Run(); err != nil {
+		fmt.Fprintf(c.stderr, "%s: error: %v\n", filename, err)
+		return exitRuntime
+	}
+	c.printResult(machine.LastPoppedStackElem())
+
+	return exitOK
+}
+
+// printResult prints the value of a program, unless it is null
+func (c *cli) printResult(result object.Object) {
+	if result != nil && result.Type() != object.NULL_OBJ {
+		fmt.Fprintln(c.stdout, result.Inspect())
+	}
+}
+
+func (c *cli) build(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	output := flags.String("o", "", "write the bytecode to `file`")
+	optimized := flags.Bool("O", false, "optimize the program before compiling it")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	path, ok := singleInput(flags.Args())
+	if !ok {
+		return c.usageError("build takes at most one file")
+	}
+
+	filename, src, err := c.readSource(path)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %v\n", err)
+		return exitUsage
+	}
+	b, _, status := c.compile(filename, src, *optimized)
+	if status != exitOK {
+		return status
+	}
+
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, b); err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %v\n", err)
+		return exitUsage
+	}
+
+	out := *output
+	if out == "" && path != "" && path != "-" {
+		out = strings.TrimSuffix(path, filepath.Ext(path)) + ".mkc"
+	}
+	if out == "" {
+		_, err = c.stdout.Write(buf.Bytes())
+	} else {
+		err = ioutil.WriteFile(out, buf.Bytes(), 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %v\n", err)
+		return exitUsage
+	}
+
+	return exitOK
+}
+
+func (c *cli) disasm(args []string) int {
+	flags := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	optimized := flags.Bool("O", false, "optimize the program before compiling it")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	path, ok := singleInput(flags.Args())
+	if !ok {
+		return c.usageError("disasm takes at most one file")
+	}
+
+	_, src, b, changes, status := c.load(path, *optimized)
+	if status != exitOK {
+		return status
+	}
+
+	if len(changes) > 0 {
+		fmt.Fprintln(c.stdout, "optimizations:")
+		for _, change := range changes {
+			fmt.Fprintf(c.stdout, "\t%s\n", change)
+		}
+		fmt.Fprintln(c.stdout)
+	}
+
+	if err := compiler.Disassemble(c.stdout, b, src); err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %v\n", err)
+		return exitUsage
+	}
+
+	return exitOK
+}
+
+func (c *cli) tokens(args []string) int {
+	path, ok := singleInput(args)
+	if !ok {
+		return c.usageError("tokens takes at most one file")
+	}
+
+	filename, src, err := c.readSource(path)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %v\n", err)
+		return exitUsage
+	}
+
+	l := lexer.NewWithMode(src, lexer.ScanComments)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(c.stdout, "%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+	if errs := l.Errors(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(c.stderr, "%s:%s: error: %s\n", filename, err.Pos, err.Message)
+		}
+		return exitSyntax
+	}
+
+	return exitOK
+}
+
+// dumpAST prints the tree even if the program has syntax errors, they are
+// reported on stderr
+func (c *cli) dumpAST(args []string) int {
+	path, ok := singleInput(args)
+	if !ok {
+		return c.usageError("ast takes at most one file")
+	}
+
+	_, program, status := c.parse(path)
+	if program == nil {
+		return status
+	}
+
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(program); err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %v\n", err)
+		return exitUsage
+	}
+
+	return status
+}
+
+func (c *cli) check(args []string) int {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+
+	status := exitOK
+	for _, path := range args {
+		if _, _, s := c.parse(path); s > status {
+			status = s
+		}
+	}
+
+	return status
+}
+
+func (c *cli) formatFiles(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	list := flags.Bool("l", false, "list files whose formatting differs from monkey fmt's")
+	write := flags.Bool("w", false, "write result to (source) file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 && *write {
+		return c.usageError("cannot use -w with standard input")
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	status := exitOK
+	for _, path := range paths {
+		if s := c.formatFile(path, *list, *write); s > status {
+			status = s
+		}
+	}
+
+	return status
+}
+
+func (c *cli) formatFile(path string, list, write bool) int {
+	filename, src, err := c.readSource(path)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "monkey: %v\n", err)
+		return exitUsage
+	}
+
+	res, err := format.Source([]byte(src))
+	if err != nil {
+		fmt.Fprintf(c.stderr, "%s:%v\n", filename, err)
+		return exitSyntax
+	}
+
+	changed := !bytes.Equal([]byte(src), res)
+	if list && changed {
+		fmt.Fprintln(c.stdout, filename)
+	}
+	if write && changed {
+		info, err := os.Stat(path)
+		if err == nil {
+			err = ioutil.WriteFile(path, res, info.Mode().Perm())
+		}
+		if err != nil {
+			fmt.Fprintf(c.stderr, "monkey: %v\n", err)
+			return exitUsage
+		}
+	}
+	if !list && !write {
+		c.stdout.Write(res)
+	}
+
+	return exitOK
+}
@@ -0,0 +1,294 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/compiler"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// monkey runs the command line args with stdin as the standard input and
+// returns the exit status and what was written to stdout and stderr
+func monkey(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := Run(args, strings.NewReader(stdin), &stdout, &stderr)
+
+	return status, stdout.String(), stderr.String()
+}
+
+// tempDir returns a new directory the caller has to remove
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestRun(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	script := writeFile(t, dir, "script.mk", "#!/usr/bin/env monkey\nlet double = fn(x) { x * 2 };\ndouble(21)\n")
+
+	tests := []struct {
+		args   []string
+		stdin  string
+		status int
+		stdout string
+		stderr string
+	}{
+		{[]string{"run", script}, "", exitOK, "42\n", ""},
+		{[]string{script}, "", exitOK, "42\n", ""},
+		{[]string{"run"}, "1 + 2", exitOK, "3\n", ""},
+		{[]string{"run", "-", "a", "b"}, "args[1]", exitOK, "b\n", ""},
+		{[]string{"run", "-O", "-", "a"}, "args[0] + \"-\" + \"x\"", exitOK, "a-x\n", ""},
+		{[]string{"run", "-O"}, "1 / 0", exitRuntime, "", "<stdin>: error: division by zero: 1 / 0\n"},
+		{[]string{"run"}, "let x = 1;", exitOK, "", ""},
+		{[]string{"run"}, "1 + true", exitRuntime, "", "<stdin>: error: type mismatch: INTEGER + BOOLEAN\n"},
+		{[]string{"run"}, "let = 1;", exitSyntax, "", "error: expected next token to be IDENT, got = instead\n" +
+			" --> <stdin>:1:5\n  |\n1 | let = 1;\n  |     ^\n"},
+		{[]string{"run", "missing.mk"}, "", exitUsage, "", "monkey: open missing.mk: no such file or directory\n"},
+	}
+
+	for _, tt := range tests {
+		status, stdout, stderr := monkey(tt.stdin, tt.args...)
+		assert.Equal(t, tt.status, status, "%v", tt.args)
+		assert.Equal(t, tt.stdout, stdout, "%v", tt.args)
+		assert.Equal(t, tt.stderr, stderr, "%v", tt.args)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	assert := assert.New(t)
+
+	status, stdout, _ := monkey("x + 1 // one", "tokens")
+	assert.Equal(exitOK, status)
+	assert.Equal("1:1\tIDENT\t\"x\"\n1:3\t+\t\"+\"\n1:5\tINT\t\"1\"\n1:7\tCOMMENT\t\"// one\"\n", stdout)
+
+	status, _, stderr := monkey(`"open`, "tokens")
+	assert.Equal(exitSyntax, status)
+	assert.Equal("<stdin>:1:1: error: unterminated string literal\n", stderr)
+
+	status, _, _ = monkey("", "tokens", "a.mk", "b.mk")
+	assert.Equal(exitUsage, status)
+}
+
+func TestAST(t *testing.T) {
+	assert := assert.New(t)
+
+	status, stdout, _ := monkey("let x = 1;", "ast")
+	assert.Equal(exitOK, status)
+
+	node, err := ast.Unmarshal([]byte(stdout))
+	if assert.NoError(err) {
+		assert.Equal("let x = 1;", node.String())
+	}
+
+	status, stdout, stderr := monkey("let x 1;", "ast")
+	assert.Equal(exitSyntax, status)
+	assert.NotEmpty(stdout)
+	assert.Contains(stderr, "expected next token to be =")
+}
+
+func TestCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	good := writeFile(t, dir, "good.mk", "let x = 1;\n")
+	bad := writeFile(t, dir, "bad.mk", "let x = ;\n")
+
+	status, stdout, stderr := monkey("", "check", good)
+	assert.Equal(exitOK, status)
+	assert.Empty(stdout)
+	assert.Empty(stderr)
+
+	status, _, stderr = monkey("", "check", good, bad)
+	assert.Equal(exitSyntax, status)
+	assert.Contains(stderr, bad+":1:9")
+
+	status, _, _ = monkey("if (", "check")
+	assert.Equal(exitSyntax, status)
+}
+
+func TestFmt(t *testing.T) {
+	assert := assert.New(t)
+
+	status, stdout, _ := monkey("let  x=1", "fmt")
+	assert.Equal(exitOK, status)
+	assert.Equal("let x = 1;\n", stdout)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "ugly.mk", "#!/usr/bin/env monkey\nx+1\n")
+	status, stdout, _ = monkey("", "fmt", "-l", path)
+	assert.Equal(exitOK, status)
+	assert.Equal(path+"\n", stdout)
+
+	status, stdout, _ = monkey("", "fmt", "-w", path)
+	assert.Equal(exitOK, status)
+	assert.Empty(stdout)
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal("#!/usr/bin/env monkey\nx + 1;\n", string(data))
+
+	status, _, _ = monkey("let = 1", "fmt")
+	assert.Equal(exitSyntax, status)
+
+	status, _, _ = monkey("", "fmt", "-w")
+	assert.Equal(exitUsage, status)
+}
+
+func TestUsage(t *testing.T) {
+	assert := assert.New(t)
+
+	status, stdout, _ := monkey("", "help")
+	assert.Equal(exitOK, status)
+	assert.Equal(usage, stdout)
+
+	status, _, stderr := monkey("", "-x")
+	assert.Equal(exitUsage, status)
+	assert.True(strings.HasPrefix(stderr, "monkey: unknown flag -x\n"))
+}
+
+func TestREPL(t *testing.T) {
+	status, stdout, _ := monkey("1 + 1\n")
+	assert.Equal(t, exitOK, status)
+	assert.Contains(t, stdout, "This is the Monkey programming language!")
+	assert.Contains(t, stdout, ">> 2\n")
+}
+
+func TestBuild(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	script := writeFile(t, dir, "double.mk", "#!/usr/bin/env monkey\nlet double = fn(x) { x * 2 };\ndouble(len)\n")
+	status, _, stderr := monkey("", "build", script)
+	assert.Equal(exitSyntax, status)
+	assert.Equal(script+":3:8: identifier not found: len\n", stderr)
+
+	script = writeFile(t, dir, "double.mk", "let double = fn(x) { x * 2 };\n[double(21), args]\n")
+	status, _, stderr = monkey("", "build", script)
+	if !assert.Equal(exitOK, status, stderr) {
+		return
+	}
+
+	bytecode := filepath.Join(dir, "double.mkc")
+	status, stdout, _ := monkey("", "run", bytecode, "a")
+	assert.Equal(exitOK, status)
+	assert.Equal("[42, [a]]\n", stdout)
+
+	status, stdout, _ = monkey("", bytecode)
+	assert.Equal(exitOK, status)
+	assert.Equal("[42, []]\n", stdout)
+
+	output := filepath.Join(dir, "out.mkc")
+	status, _, _ = monkey("", "build", "-o", output, script)
+	assert.Equal(exitOK, status)
+	data, err := ioutil.ReadFile(output)
+	assert.NoError(err)
+
+	status, stdout, _ = monkey("1 / 0", "build")
+	assert.Equal(exitOK, status)
+	status, _, stderr = monkey(stdout, "run")
+	assert.Equal(exitRuntime, status)
+	assert.Equal("<stdin>: error: division by zero: 1 / 0\n", stderr)
+
+	data[len(data)-1] ^= 0xff
+	status, _, stderr = monkey(string(data), "run")
+	assert.Equal(exitUsage, status)
+	assert.Equal("<stdin>: compiler: corrupt bytecode file: checksum mismatch\n", stderr)
+
+	status, _, _ = monkey("", "build", "a.mk", "b.mk")
+	assert.Equal(exitUsage, status)
+}
+
+func TestDisasm(t *testing.T) {
+	assert := assert.New(t)
+
+	status, stdout, _ := monkey("let x = 1;\nx + 2", "disasm")
+	assert.Equal(exitOK, status)
+	assert.Equal(`constants:
+	0	INTEGER 1
+	1	INTEGER 2
+
+main:
+	; 1 | let x = 1;
+	0000 OpConstant 0
+	0003 OpSetGlobal 1
+	; 2 | x + 2
+	0006 OpGetGlobal 1
+	0009 OpConstant 1
+	0012 OpAdd
+	0013 OpPop
+`, stdout)
+
+	_, bytecode, _ := monkey("let x = 1;\nx + 2", "build")
+	status, stdout, _ = monkey(bytecode, "disasm")
+	assert.Equal(exitOK, status)
+	assert.Contains(stdout, "main:\n\t; line 1\n\t0000 OpConstant 0\n")
+
+	status, _, stderr := monkey(compiler.BytecodeMagic+"\x00\x09", "disasm")
+	assert.Equal(exitUsage, status)
+	assert.Equal("<stdin>: compiler: bytecode version 9 is not supported, want version 1\n", stderr)
+
+	status, _, _ = monkey("let = 1", "disasm")
+	assert.Equal(exitSyntax, status)
+}
+
+func TestOptimize(t *testing.T) {
+	assert := assert.New(t)
+
+	status, stdout, _ := monkey("let day = 60 * 60 * 24;\nday * 1", "disasm", "-O")
+	assert.Equal(exitOK, status)
+	assert.Equal(`optimizations:
+	1:11: 60 * 60 => 3600
+	1:11: 3600 * 24 => 86400
+
+constants:
+	0	INTEGER 86400
+	1	INTEGER 1
+
+main:
+	; 1 | let day = 60 * 60 * 24;
+	0000 OpConstant 0
+	0003 OpSetGlobal 1
+	; 2 | day * 1
+	0006 OpGetGlobal 1
+	0009 OpConstant 1
+	0012 OpMul
+	0013 OpPop
+`, stdout)
+
+	status, stdout, _ = monkey("x", "disasm", "-O")
+	assert.Equal(exitSyntax, status)
+	assert.Empty(stdout)
+
+	status, bytecode, _ := monkey("2 * 3 + 1", "build", "-O")
+	assert.Equal(exitOK, status)
+	status, stdout, _ = monkey(bytecode, "disasm")
+	assert.Equal(exitOK, status)
+	assert.Contains(stdout, "constants:\n\t0\tINTEGER 7\n\n")
+}
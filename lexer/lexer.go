@@ -1,38 +1,117 @@
 package lexer
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/rsb/monkey_interpreter/token"
 )
 
+// Error describes a malformed lexeme. Pos and End delimit the offending
+// source range
+type Error struct {
+	Pos     token.Position
+	End     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// Mode controls how the lexer treats comments. By default comments are
+// skipped like whitespace
+type Mode uint
+
+const (
+	// ScanComments returns every comment as a COMMENT token
+	ScanComments Mode = 1 << iota
+	// AttachComments keeps comments as Leading and Trailing trivia of the
+	// tokens surrounding them. It is ignored when ScanComments is set
+	AttachComments
+)
+
 // Lexer is responsible for scanning the input and converting them
-// into tokens
+// into tokens. The input is decoded as UTF-8, columns count runes while
+// offsets count bytes
 type Lexer struct {
-	input        string
+	input        []byte
 	position     int
 	readPosition int
-	ch           byte
+	ch           rune
+
+	// input only holds the part of the source starting at byte offset base.
+	// While reader is set more of the source can be read into input, bytes
+	// before mark are no longer needed and may be discarded to make room
+	base    int
+	mark    int
+	reader  io.Reader
+	readErr error
+
+	readErrReported bool
+
+	// line and column of the char at position
+	line   int
+	column int
+
+	mode   Mode
+	errors []*Error
 }
 
 // New constructor used to create a new Lexer with the input set
 func New(input string) *Lexer {
-	l := Lexer{input: input}
+	return NewWithMode(input, 0)
+}
+
+// NewWithMode creates a new Lexer treating comments according to mode
+func NewWithMode(input string, mode Mode) *Lexer {
+	l := Lexer{input: []byte(input), line: 1, mode: mode}
 	l.readChar()
 	return &l
 }
 
+// Errors returns every malformed lexeme found so far, in source order
+func (l *Lexer) Errors() []*Error {
+	return l.errors
+}
+
 // NextToken reads the next char and converts it into a token
 func (l *Lexer) NextToken() token.Token {
+	leading := l.skipTrivia()
+	tok := l.scanToken()
+
+	if l.mode&(ScanComments|AttachComments) == AttachComments {
+		tok.Leading = leading
+		if tok.Type != token.EOF {
+			tok.Trailing = l.readTrailingComments()
+		}
+	}
+
+	return tok
+}
+
+func (l *Lexer) scanToken() token.Token {
 	var tok token.Token
+	pos := l.pos()
+	l.mark = l.position
 
-	l.skipWhitespace()
+	if l.isCommentStart() {
+		comment := l.readComment()
+		tok.Type = token.COMMENT
+		tok.Literal = comment.Text
+		tok.Pos, tok.End = comment.Pos, comment.End
+
+		return tok
+	}
 
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal}
+			tok = l.readTwoCharToken(token.EQ)
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -42,10 +121,7 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.MINUS, l.ch)
 	case '!':
 		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
+			tok = l.readTwoCharToken(token.NOT_EQ)
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
@@ -53,74 +129,364 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SLASH, l.ch)
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.LT_EQ)
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.GT_EQ)
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.readTwoCharToken(token.AND)
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.readTwoCharToken(token.OR)
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
+	case '"':
+		tok.Type = token.STRING
+		tok.Literal = l.readString()
+		tok.Pos, tok.End = pos, l.pos()
+
+		return tok
 	case 0:
+		l.reportReadError()
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos, tok.End = pos, l.pos()
 
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Pos, tok.End = pos, l.pos()
 
 			return tok
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			// sliced from the input so invalid UTF-8 keeps its original byte
+			tok.Type = token.ILLEGAL
+			tok.Literal = l.slice(l.position, l.readPosition)
 		}
 	}
 
 	l.readChar()
+	tok.Pos, tok.End = pos, l.pos()
 	return tok
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// readTwoCharToken consumes the current char so the token is made of it and
+// the next one
+func (l *Lexer) readTwoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
+// pos reports the source position of the current char
+func (l *Lexer) pos() token.Position {
+	return token.Position{Offset: l.position, Line: l.line, Column: l.column}
+}
+
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
+	// Once the end of the input has been reached the position stays put, so
+	// every EOF token reports the same location
+	if l.readPosition > 0 && l.atEnd(l.position) {
+		return
+	}
+
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
+	width := 1
+	if l.atEnd(l.readPosition) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.fill(l.readPosition + utf8.UTFMax)
+		l.ch, width = utf8.DecodeRune(l.input[l.readPosition-l.base:])
 	}
 
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
+	l.column++
+
+	if l.ch == utf8.RuneError && width == 1 {
+		end := l.pos()
+		end.Offset++
+		end.Column++
+		l.errors = append(l.errors, &Error{Pos: l.pos(), End: end, Message: "invalid UTF-8 encoding"})
+	}
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber consumes an integer or float literal. Malformed literals such
+// as 0x or 1__0 are still consumed whole, the parser reports them
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	position := l.position
-	for isDigit(l.ch) {
+
+	if l.ch == '0' && strings.ContainsRune("xXoObB", l.peekChar()) {
+		l.readChar()
+		l.readChar()
+		for isHexDigit(l.ch) || l.ch == '_' {
+			l.readChar()
+		}
+
+		return token.INT, l.slice(position, l.position)
+	}
+
+	tokType := token.TokenType(token.INT)
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		tokType = token.FLOAT
 		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		l.readDigits()
 	}
-	return l.input[position:l.position]
+
+	return tokType, l.slice(position, l.position)
+}
+
+// readDigits consumes decimal digits and the underscores separating them
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+}
+
+// readString consumes a double quoted string, including both quotes, and
+// returns its contents with escape sequences decoded
+func (l *Lexer) readString() string {
+	var out bytes.Buffer
+	start := l.pos()
+
+	l.readChar()
+	for {
+		switch l.ch {
+		case '"':
+			l.readChar()
+			return out.String()
+		case 0:
+			if l.atEnd(l.position) {
+				l.error(start, "unterminated string literal")
+				return out.String()
+			}
+			out.WriteRune(l.ch)
+			l.readChar()
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteRune(l.ch)
+			l.readChar()
+		}
+	}
+}
+
+// readEscape decodes the escape sequence starting at the current backslash
+// into out
+func (l *Lexer) readEscape(out *bytes.Buffer) {
+	start := l.pos()
+	l.readChar()
+
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case 'u':
+		l.readUnicodeEscape(start, out)
+		return
+	default:
+		if l.atEnd(l.position) {
+			// let readString report the missing closing quote
+			return
+		}
+		l.readChar()
+		l.error(start, fmt.Sprintf("unknown escape sequence %q", l.slice(start.Offset, l.position)))
+		return
+	}
+
+	l.readChar()
+}
+
+// readUnicodeEscape decodes a \u{XXXX} escape made of one to six hex digits.
+// The current char is the u
+func (l *Lexer) readUnicodeEscape(start token.Position, out *bytes.Buffer) {
+	l.readChar()
+	if l.ch != '{' {
+		l.error(start, `malformed unicode escape, expected \u{XXXX}`)
+		return
+	}
+	l.readChar()
+
+	var value rune
+	digits := 0
+	for isHexDigit(l.ch) {
+		value = value*16 + hexValue(l.ch)
+		digits++
+		l.readChar()
+	}
+
+	closed := l.ch == '}'
+	if closed {
+		l.readChar()
+	}
+
+	if !closed || digits == 0 || digits > 6 {
+		l.error(start, `malformed unicode escape, expected \u{XXXX}`)
+		return
+	}
+
+	if !utf8.ValidRune(value) {
+		l.error(start, fmt.Sprintf("invalid unicode code point %q", l.slice(start.Offset, l.position)))
+		return
+	}
+
+	out.WriteRune(value)
+}
+
+// error records a malformed lexeme spanning from start to the current char
+func (l *Lexer) error(start token.Position, msg string) {
+	l.errors = append(l.errors, &Error{Pos: start, End: l.pos(), Message: msg})
 }
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return l.slice(position, l.position)
+}
+
+// skipTrivia skips whitespace and, unless they are scanned as tokens,
+// comments. The skipped comments are returned in source order
+func (l *Lexer) skipTrivia() []token.Comment {
+	var comments []token.Comment
+
+	for {
+		l.skipWhitespace()
+		if l.mode&ScanComments != 0 || !l.isCommentStart() {
+			return comments
+		}
+		comments = append(comments, l.readComment())
+	}
+}
+
+// readTrailingComments consumes the comments starting on the current line
+func (l *Lexer) readTrailingComments() []token.Comment {
+	var comments []token.Comment
+
+	for {
+		for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' {
+			l.readChar()
+		}
+		if !l.isCommentStart() {
+			return comments
+		}
+		comments = append(comments, l.readComment())
+	}
+}
+
+// isCommentStart reports whether a comment starts at the current
+// character. A #! line at the very start of the input is a comment so that
+// scripts can be made executable
+func (l *Lexer) isCommentStart() bool {
+	switch l.ch {
+	case '/':
+		return l.peekChar() == '/' || l.peekChar() == '*'
+	case '#':
+		return l.peekChar() == '!' && l.pos().Offset == 0
+	}
+
+	return false
+}
+
+// readComment consumes a // or #! comment up to the end of the line or a,
+// possibly nested, /* */ comment
+func (l *Lexer) readComment() token.Comment {
+	pos := l.pos()
+	l.mark = l.position
+
+	l.readChar()
+	if l.ch == '/' || l.ch == '!' {
+		for l.ch != '\n' && !l.atEnd(l.position) {
+			l.readChar()
+		}
+	} else {
+		l.readChar()
+		for depth := 1; depth > 0; {
+			switch {
+			case l.atEnd(l.position):
+				l.error(pos, "unterminated block comment")
+				depth = 0
+			case l.ch == '/' && l.peekChar() == '*':
+				l.readChar()
+				l.readChar()
+				depth++
+			case l.ch == '*' && l.peekChar() == '/':
+				l.readChar()
+				l.readChar()
+				depth--
+			default:
+				l.readChar()
+			}
+		}
+	}
+
+	return token.Comment{
+		Text: l.slice(pos.Offset, l.position),
+		Pos:  pos,
+		End:  l.pos(),
+	}
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -129,18 +495,39 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+func (l *Lexer) peekChar() rune {
+	if l.atEnd(l.readPosition) {
 		return 0
 	} else {
-		return l.input[l.readPosition]
+		l.fill(l.readPosition + utf8.UTFMax)
+		r, _ := utf8.DecodeRune(l.input[l.readPosition-l.base:])
+		return r
 	}
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// isLetter reports whether ch may start an identifier. Identifiers continue
+// with letters and digits
+func isLetter(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch)
 }
 
-func isDigit(ch byte) bool {
+// isDigit only accepts ASCII digits, numeric literals are never written
+// with other scripts
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func hexValue(ch rune) rune {
+	switch {
+	case isDigit(ch):
+		return ch - '0'
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
+	}
+}
@@ -1,6 +1,7 @@
 package lexer_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/rsb/monkey_interpreter/lexer"
@@ -46,7 +47,7 @@ func TestNextTokenStatements(t *testing.T) {
 	};
 
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 	`
 
@@ -182,3 +183,401 @@ func TestNextTokenStatementsWithPeekAHead(t *testing.T) {
 		assert.Equal(tok.Literal, tt.expectedLiteral)
 	}
 }
+
+func TestNextTokenPositions(t *testing.T) {
+	assert := assert.New(t)
+	input := "let x = 10;\n  x == 10;\n"
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+		expectedEnd  token.Position
+	}{
+		{token.LET, token.Position{Offset: 0, Line: 1, Column: 1}, token.Position{Offset: 3, Line: 1, Column: 4}},
+		{token.IDENT, token.Position{Offset: 4, Line: 1, Column: 5}, token.Position{Offset: 5, Line: 1, Column: 6}},
+		{token.ASSIGN, token.Position{Offset: 6, Line: 1, Column: 7}, token.Position{Offset: 7, Line: 1, Column: 8}},
+		{token.INT, token.Position{Offset: 8, Line: 1, Column: 9}, token.Position{Offset: 10, Line: 1, Column: 11}},
+		{token.SEMICOLON, token.Position{Offset: 10, Line: 1, Column: 11}, token.Position{Offset: 11, Line: 1, Column: 12}},
+		{token.IDENT, token.Position{Offset: 14, Line: 2, Column: 3}, token.Position{Offset: 15, Line: 2, Column: 4}},
+		{token.EQ, token.Position{Offset: 16, Line: 2, Column: 5}, token.Position{Offset: 18, Line: 2, Column: 7}},
+		{token.INT, token.Position{Offset: 19, Line: 2, Column: 8}, token.Position{Offset: 21, Line: 2, Column: 10}},
+		{token.SEMICOLON, token.Position{Offset: 21, Line: 2, Column: 10}, token.Position{Offset: 22, Line: 2, Column: 11}},
+		{token.EOF, token.Position{Offset: 23, Line: 3, Column: 1}, token.Position{Offset: 23, Line: 3, Column: 1}},
+		{token.EOF, token.Position{Offset: 23, Line: 3, Column: 1}, token.Position{Offset: 23, Line: 3, Column: 1}},
+	}
+
+	l := lexer.New(input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+		assert.Equal(tt.expectedType, tok.Type)
+		assert.Equal(tt.expectedPos, tok.Pos, "wrong start for %q", tok.Literal)
+		assert.Equal(tt.expectedEnd, tok.End, "wrong end for %q", tok.Literal)
+	}
+}
+
+func TestNextTokenStrings(t *testing.T) {
+	assert := assert.New(t)
+	input := `"foobar" "foo bar" "" "a\nb\tc" "say \"hi\"" "back\\slash" "\u{48}\u{49}" "\u{1F600}" "héllo"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.STRING, ""},
+		{token.STRING, "a\nb\tc"},
+		{token.STRING, `say "hi"`},
+		{token.STRING, `back\slash`},
+		{token.STRING, "HI"},
+		{token.STRING, "\U0001F600"},
+		{token.STRING, "héllo"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+		assert.Equal(tt.expectedType, tok.Type)
+		assert.Equal(tt.expectedLiteral, tok.Literal)
+	}
+	assert.Empty(l.Errors())
+}
+
+func TestNextTokenStringErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedMessage string
+		expectedPos     string
+		expectedEnd     string
+	}{
+		{`x = "abc`, "abc", "unterminated string literal", "1:5", "1:9"},
+		{`"abc\`, "abc", "unterminated string literal", "1:1", "1:6"},
+		{`"a\qb"`, "ab", `unknown escape sequence "\\q"`, "1:3", "1:5"},
+		{`"\u41"`, "41", `malformed unicode escape, expected \u{XXXX}`, "1:2", "1:4"},
+		{`"\u{}"`, "", `malformed unicode escape, expected \u{XXXX}`, "1:2", "1:6"},
+		{`"\u{1234567}"`, "", `malformed unicode escape, expected \u{XXXX}`, "1:2", "1:13"},
+		{`"\u{D800}"`, "", `invalid unicode code point "\\u{D800}"`, "1:2", "1:10"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+
+		var tok token.Token
+		for tok = l.NextToken(); tok.Type != token.STRING && tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		assert.Equal(token.TokenType(token.STRING), tok.Type, "input %q", tt.input)
+		assert.Equal(tt.expectedLiteral, tok.Literal, "input %q", tt.input)
+
+		errs := l.Errors()
+		if assert.Len(errs, 1, "input %q", tt.input) {
+			assert.Equal(tt.expectedMessage, errs[0].Message)
+			assert.Equal(tt.expectedPos, errs[0].Pos.String(), "input %q", tt.input)
+			assert.Equal(tt.expectedEnd, errs[0].End.String(), "input %q", tt.input)
+		}
+	}
+}
+
+func TestNextTokenCollections(t *testing.T) {
+	assert := assert.New(t)
+	input := `[1, 2]; {"foo": "bar"}; xs[0]`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "xs"},
+		{token.LBRACKET, "["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+		assert.Equal(tt.expectedType, tok.Type)
+		assert.Equal(tt.expectedLiteral, tok.Literal)
+	}
+}
+
+const commentedInput = `// leading
+let x = 5; // trailing
+/* block /* nested */ still comment */ x
+// last`
+
+func TestNextTokenSkipsComments(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(commentedInput)
+	for _, tt := range tests {
+		tok := l.NextToken()
+		assert.Equal(tt.expectedType, tok.Type)
+		assert.Equal(tt.expectedLiteral, tok.Literal)
+		assert.Nil(tok.Leading)
+		assert.Nil(tok.Trailing)
+	}
+	assert.Empty(l.Errors())
+}
+
+func TestNextTokenScanComments(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.COMMENT, "// leading"},
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// trailing"},
+		{token.COMMENT, "/* block /* nested */ still comment */"},
+		{token.IDENT, "x"},
+		{token.COMMENT, "// last"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.NewWithMode(commentedInput, lexer.ScanComments)
+	for _, tt := range tests {
+		tok := l.NextToken()
+		assert.Equal(tt.expectedType, tok.Type)
+		assert.Equal(tt.expectedLiteral, tok.Literal)
+	}
+}
+
+func TestNextTokenAttachComments(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLeading  []string
+		expectedTrailing []string
+	}{
+		{token.LET, []string{"// leading"}, nil},
+		{token.IDENT, nil, nil},
+		{token.ASSIGN, nil, nil},
+		{token.INT, nil, nil},
+		{token.SEMICOLON, nil, []string{"// trailing"}},
+		{token.IDENT, []string{"/* block /* nested */ still comment */"}, nil},
+		{token.EOF, []string{"// last"}, nil},
+	}
+
+	l := lexer.NewWithMode(commentedInput, lexer.AttachComments)
+	for _, tt := range tests {
+		tok := l.NextToken()
+		assert.Equal(tt.expectedType, tok.Type)
+
+		var leading, trailing []string
+		for _, c := range tok.Leading {
+			leading = append(leading, c.Text)
+		}
+		for _, c := range tok.Trailing {
+			trailing = append(trailing, c.Text)
+		}
+		assert.Equal(tt.expectedLeading, leading, "leading comments of %q", tok.Literal)
+		assert.Equal(tt.expectedTrailing, trailing, "trailing comments of %q", tok.Literal)
+	}
+
+	tok := lexer.NewWithMode("// a\n  x", lexer.AttachComments).NextToken()
+	assert.Equal(token.Position{Offset: 0, Line: 1, Column: 1}, tok.Leading[0].Pos)
+	assert.Equal(token.Position{Offset: 4, Line: 1, Column: 5}, tok.Leading[0].End)
+}
+
+func TestNextTokenShebang(t *testing.T) {
+	assert := assert.New(t)
+
+	input := "#!/usr/bin/env monkey run\nx"
+
+	l := lexer.NewWithMode(input, lexer.ScanComments)
+	tok := l.NextToken()
+	assert.Equal(token.TokenType(token.COMMENT), tok.Type)
+	assert.Equal("#!/usr/bin/env monkey run", tok.Literal)
+	assert.Equal(token.TokenType(token.IDENT), l.NextToken().Type)
+
+	l = lexer.New(input)
+	assert.Equal(token.TokenType(token.IDENT), l.NextToken().Type)
+	assert.Equal(token.TokenType(token.EOF), l.NextToken().Type)
+	assert.Empty(l.Errors())
+
+	// only the first line can hold a shebang
+	l = lexer.New("x\n#!y")
+	assert.Equal(token.TokenType(token.IDENT), l.NextToken().Type)
+	assert.Equal(token.TokenType(token.ILLEGAL), l.NextToken().Type)
+
+	l = lexer.NewReader(strings.NewReader(input))
+	assert.Equal(token.TokenType(token.IDENT), l.NextToken().Type)
+}
+
+func TestNextTokenUnterminatedBlockComment(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lexer.New("x /* open /* nested */")
+	assert.Equal(token.TokenType(token.IDENT), l.NextToken().Type)
+	assert.Equal(token.TokenType(token.EOF), l.NextToken().Type)
+
+	errs := l.Errors()
+	if assert.Len(errs, 1) {
+		assert.Equal("unterminated block comment", errs[0].Message)
+		assert.Equal("1:3", errs[0].Pos.String())
+	}
+}
+
+func TestNextTokenUnicode(t *testing.T) {
+	assert := assert.New(t)
+	input := "let größe = \"日本\"; λx1 + π_2;"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{token.LET, "let", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.IDENT, "größe", token.Position{Offset: 4, Line: 1, Column: 5}},
+		{token.ASSIGN, "=", token.Position{Offset: 12, Line: 1, Column: 11}},
+		{token.STRING, "日本", token.Position{Offset: 14, Line: 1, Column: 13}},
+		{token.SEMICOLON, ";", token.Position{Offset: 22, Line: 1, Column: 17}},
+		{token.IDENT, "λx1", token.Position{Offset: 24, Line: 1, Column: 19}},
+		{token.PLUS, "+", token.Position{Offset: 29, Line: 1, Column: 23}},
+		{token.IDENT, "π_2", token.Position{Offset: 31, Line: 1, Column: 25}},
+		{token.SEMICOLON, ";", token.Position{Offset: 35, Line: 1, Column: 28}},
+		{token.EOF, "", token.Position{Offset: 36, Line: 1, Column: 29}},
+	}
+
+	l := lexer.New(input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+		assert.Equal(tt.expectedType, tok.Type)
+		assert.Equal(tt.expectedLiteral, tok.Literal)
+		assert.Equal(tt.expectedPos, tok.Pos, "position of %q", tok.Literal)
+	}
+	assert.Empty(l.Errors())
+}
+
+func TestNextTokenInvalidUTF8(t *testing.T) {
+	assert := assert.New(t)
+	input := "x = \xff;\n\"a\xfeb\""
+
+	l := lexer.New(input)
+	assert.Equal(token.TokenType(token.IDENT), l.NextToken().Type)
+	assert.Equal(token.TokenType(token.ASSIGN), l.NextToken().Type)
+
+	tok := l.NextToken()
+	assert.Equal(token.TokenType(token.ILLEGAL), tok.Type)
+	assert.Equal("\xff", tok.Literal)
+
+	assert.Equal(token.TokenType(token.SEMICOLON), l.NextToken().Type)
+	assert.Equal(token.TokenType(token.STRING), l.NextToken().Type)
+	assert.Equal(token.TokenType(token.EOF), l.NextToken().Type)
+
+	errs := l.Errors()
+	if assert.Len(errs, 2) {
+		assert.Equal("invalid UTF-8 encoding", errs[0].Message)
+		assert.Equal(token.Position{Offset: 4, Line: 1, Column: 5}, errs[0].Pos)
+		assert.Equal(token.Position{Offset: 5, Line: 1, Column: 6}, errs[0].End)
+		assert.Equal("invalid UTF-8 encoding", errs[1].Message)
+		assert.Equal(token.Position{Offset: 9, Line: 2, Column: 3}, errs[1].Pos)
+	}
+}
+
+func TestNextTokenNumbers(t *testing.T) {
+	assert := assert.New(t)
+	input := `5 1_000_000 0xFF 0o17 0b1010 3.14 1e10 2.5E-3 6e+2 0x 1__0 010 08 1.x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.INT, "1_000_000"},
+		{token.INT, "0xFF"},
+		{token.INT, "0o17"},
+		{token.INT, "0b1010"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e10"},
+		{token.FLOAT, "2.5E-3"},
+		{token.FLOAT, "6e+2"},
+		{token.INT, "0x"},
+		{token.INT, "1__0"},
+		{token.INT, "010"},
+		{token.INT, "08"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+		assert.Equal(tt.expectedType, tok.Type)
+		assert.Equal(tt.expectedLiteral, tok.Literal)
+	}
+}
+
+func TestNextTokenComparisonAndLogicalOperators(t *testing.T) {
+	assert := assert.New(t)
+	input := `a <= b >= c && d || e % 2 < 1 > 0 & |`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.AND, "&&"},
+		{token.IDENT, "d"},
+		{token.OR, "||"},
+		{token.IDENT, "e"},
+		{token.PERCENT, "%"},
+		{token.INT, "2"},
+		{token.LT, "<"},
+		{token.INT, "1"},
+		{token.GT, ">"},
+		{token.INT, "0"},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.EOF, ""},
+	}
+
+	l := lexer.New(input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+		assert.Equal(tt.expectedType, tok.Type)
+		assert.Equal(tt.expectedLiteral, tok.Literal)
+	}
+}
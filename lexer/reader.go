@@ -0,0 +1,103 @@
+package lexer
+
+import (
+	"fmt"
+	"io"
+)
+
+// chunkSize is the number of bytes requested from the reader at a time. The
+// buffer only grows beyond it to hold a single token longer than a chunk
+const chunkSize = 4096
+
+// maxEmptyReads is the number of reads in a row returning no data and no
+// error after which the reader is considered broken, as in bufio
+const maxEmptyReads = 100
+
+// NewReader creates a Lexer reading its input incrementally from r
+func NewReader(r io.Reader) *Lexer {
+	return NewReaderWithMode(r, 0)
+}
+
+// NewReaderWithMode creates a Lexer reading its input incrementally from r
+// and treating comments according to mode
+func NewReaderWithMode(r io.Reader, mode Mode) *Lexer {
+	l := Lexer{reader: r, line: 1, mode: mode}
+	l.readChar()
+	return &l
+}
+
+// Err returns the first error returned by the underlying reader, other than
+// io.EOF. The token stream ends with EOF as soon as the reader fails
+func (l *Lexer) Err() error {
+	return l.readErr
+}
+
+// slice returns the source between the byte offsets start and end
+func (l *Lexer) slice(start, end int) string {
+	return string(l.input[start-l.base : end-l.base])
+}
+
+// atEnd reports whether the source ends before offset
+func (l *Lexer) atEnd(offset int) bool {
+	return !l.fill(offset + 1)
+}
+
+// fill reads from the reader until every byte before offset is buffered. It
+// returns false when the source ends first
+func (l *Lexer) fill(offset int) bool {
+	for offset > l.base+len(l.input) {
+		if l.reader == nil {
+			return false
+		}
+		l.read()
+	}
+
+	return true
+}
+
+// read discards the bytes before mark and appends the next chunk of the
+// reader to input. A reader that keeps returning nothing fails with
+// io.ErrNoProgress
+func (l *Lexer) read() {
+	keep := l.input[l.mark-l.base:]
+	if cap(l.input)-len(keep) < chunkSize {
+		buf := make([]byte, len(keep), len(keep)+chunkSize)
+		copy(buf, keep)
+		l.input = buf
+	} else {
+		l.input = l.input[:copy(l.input, keep)]
+	}
+	l.base = l.mark
+
+	for i := 0; i < maxEmptyReads; i++ {
+		n, err := l.reader.Read(l.input[len(l.input) : len(l.input)+chunkSize])
+		l.input = l.input[:len(l.input)+n]
+
+		if err == io.EOF {
+			l.reader = nil
+			return
+		} else if err != nil {
+			l.reader = nil
+			l.readErr = err
+			return
+		}
+		if n > 0 {
+			return
+		}
+	}
+
+	l.reader = nil
+	l.readErr = io.ErrNoProgress
+}
+
+// reportReadError records the read error, if any, at the position where the
+// source was cut short
+func (l *Lexer) reportReadError() {
+	if l.readErr == nil || l.readErrReported {
+		return
+	}
+	l.readErrReported = true
+
+	end := l.pos()
+	l.errors = append(l.errors, &Error{Pos: end, End: end, Message: fmt.Sprintf("read error: %s", l.readErr)})
+}
@@ -0,0 +1,127 @@
+package lexer_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/rsb/monkey_interpreter/lexer"
+	"github.com/rsb/monkey_interpreter/token"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sharedInputs = []string{
+	"",
+	"=+(){},;",
+	`let five = 5;
+	let ten = 10;
+	let add = fn(x, y) { x + y; };
+	let result = add(five, ten);
+	!-/ *5;
+	5 < 10 > 5;
+	if (5 < 10) { return true; } else { return false; }
+	10 == 10; 10 != 9;`,
+	`[1, 2]; {"foo": "bar"}; xs[0]`,
+	`"a\nb\tc" "say \"hi\"" "\u{1F600}" "unterminated`,
+	commentedInput,
+	"let größe = \"日本\"; λx1 + π_2;",
+	"x = \xff;\n\"a\xfeb\"",
+	"/* open",
+	`a <= b >= c && d || e % 2 < 1 > 0 & |`,
+	`5 1_000_000 0xFF 0o17 0b1010 3.14 1e10 2.5E-3 6e+2 0x 1__0 1.x`,
+	strings.Repeat("let x = \"0123456789abcdef\"; // comment\n", 500),
+	`"` + strings.Repeat("long string ", 1000) + `"`,
+}
+
+func collectTokens(l *lexer.Lexer) []token.Token {
+	var tokens []token.Token
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
+func TestNewReaderMatchesNew(t *testing.T) {
+	assert := assert.New(t)
+
+	readers := map[string]func(io.Reader) io.Reader{
+		"plain":    func(r io.Reader) io.Reader { return r },
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+		"data err": iotest.DataErrReader,
+	}
+
+	for _, mode := range []lexer.Mode{0, lexer.ScanComments, lexer.AttachComments} {
+		for _, input := range sharedInputs {
+			expectedLexer := lexer.NewWithMode(input, mode)
+			expected := collectTokens(expectedLexer)
+
+			for name, wrap := range readers {
+				l := lexer.NewReaderWithMode(wrap(strings.NewReader(input)), mode)
+				actual := collectTokens(l)
+
+				assert.Equal(expected, actual, "%s reader, mode %d, input %.40q", name, mode, input)
+				assert.Equal(expectedLexer.Errors(), l.Errors(), "%s reader, mode %d, input %.40q", name, mode, input)
+				assert.NoError(l.Err())
+			}
+		}
+	}
+}
+
+func TestNewReaderReadError(t *testing.T) {
+	assert := assert.New(t)
+
+	r := iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("let x = 5;")))
+	l := lexer.NewReader(r)
+
+	tok := l.NextToken()
+	assert.Equal(token.TokenType(token.IDENT), tok.Type)
+	assert.Equal("l", tok.Literal)
+	assert.Equal(token.TokenType(token.EOF), l.NextToken().Type)
+
+	assert.Equal(iotest.ErrTimeout, l.Err())
+	errs := l.Errors()
+	if assert.Len(errs, 1) {
+		assert.Equal("read error: timeout", errs[0].Message)
+		assert.Equal("1:2", errs[0].Pos.String())
+	}
+}
+
+// emptyReader returns no data and no error after its input is exhausted
+type emptyReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (r *emptyReader) Read(p []byte) (int, error) {
+	r.reads++
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		return 0, nil
+	}
+
+	return n, err
+}
+
+func TestNewReaderNoProgress(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &emptyReader{r: strings.NewReader("x")}
+	l := lexer.NewReader(r)
+
+	tok := l.NextToken()
+	assert.Equal(token.TokenType(token.IDENT), tok.Type)
+	assert.Equal(token.TokenType(token.EOF), l.NextToken().Type)
+
+	assert.Equal(io.ErrNoProgress, l.Err())
+	assert.Less(r.reads, 200)
+	errs := l.Errors()
+	if assert.Len(errs, 1) {
+		assert.Equal("read error: multiple Read calls return no data or error", errs[0].Message)
+	}
+}
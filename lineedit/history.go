@@ -0,0 +1,152 @@
+package lineedit
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultHistorySize is the number of entries kept by NewHistory
+const DefaultHistorySize = 1000
+
+// History is the list of lines entered so far, oldest first. A History
+// opened on a file appends every new entry to it
+type History struct {
+	entries []string
+	max     int
+	path    string
+}
+
+// NewHistory returns an empty in-memory history keeping up to max entries
+func NewHistory(max int) *History {
+	return &History{max: max}
+}
+
+// OpenHistory loads the history stored at path, creating its directory if
+// needed. The file is rewritten when it holds more than max entries
+func OpenHistory(path string, max int) (*History, error) {
+	h := NewHistory(max)
+
+	f, err := os.Open(path)
+	switch {
+	case os.IsNotExist(err):
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		defer f.Close()
+		lines := 0
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			h.add(scanner.Text())
+			lines++
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+
+		// trim a file that grew past max
+		if lines > len(h.entries) {
+			if err := h.rewrite(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	h.path = path
+
+	return h, nil
+}
+
+// DefaultHistoryPath returns the file the history of the named program is
+// kept in, under the user's configuration directory
+func DefaultHistoryPath(program string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, program, "history"), nil
+}
+
+// Len returns the number of entries
+func (h *History) Len() int { return len(h.entries) }
+
+// At returns the i-th entry, 0 being the oldest
+func (h *History) At(i int) string { return h.entries[i] }
+
+// Add records line, unless it is blank or repeats the latest entry. The
+// line is appended to the history file if there is one
+func (h *History) Add(line string) error {
+	if !h.add(line) || h.path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (h *History) add(line string) bool {
+	if strings.TrimSpace(line) == "" || strings.ContainsAny(line, "\r\n") {
+		return false
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return false
+	}
+
+	h.entries = append(h.entries, line)
+	if h.max > 0 && len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+	}
+
+	return true
+}
+
+// Search returns the index of the newest entry before from containing
+// query, or -1
+func (h *History) Search(query string, from int) int {
+	if from > len(h.entries) {
+		from = len(h.entries)
+	}
+
+	for i := from - 1; i >= 0; i-- {
+		if strings.Contains(h.entries[i], query) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (h *History) rewrite(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, line := range h.entries {
+		w.WriteString(line + "\n")
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,87 @@
+package lineedit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryAdd(t *testing.T) {
+	h := NewHistory(3)
+	for _, line := range []string{"a", "", "  ", "b", "b", "multi\nline", "c", "d"} {
+		assert.NoError(t, h.Add(line))
+	}
+
+	var entries []string
+	for i := 0; i < h.Len(); i++ {
+		entries = append(entries, h.At(i))
+	}
+	assert.Equal(t, []string{"b", "c", "d"}, entries)
+}
+
+func TestHistorySearch(t *testing.T) {
+	h := NewHistory(0)
+	for _, line := range []string{"let a = 1;", "a + 1", "let b = a;"} {
+		h.Add(line)
+	}
+
+	assert.Equal(t, 2, h.Search("let", h.Len()))
+	assert.Equal(t, 0, h.Search("let", 2))
+	assert.Equal(t, -1, h.Search("let", 0))
+	assert.Equal(t, 1, h.Search("+", 100))
+	assert.Equal(t, -1, h.Search("fn", h.Len()))
+}
+
+func TestOpenHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lineedit")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "monkey", "history")
+	h, err := OpenHistory(path, 3)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 0, h.Len())
+
+	for _, line := range []string{"one", "two", "three", "four"} {
+		assert.NoError(t, h.Add(line))
+	}
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "one\ntwo\nthree\nfour\n", string(data))
+
+	// reopening keeps the last entries and trims the file
+	h, err = OpenHistory(path, 3)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 3, h.Len())
+	assert.Equal(t, "two", h.At(0))
+	assert.Equal(t, "four", h.At(2))
+
+	data, err = ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "two\nthree\nfour\n", string(data))
+
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func TestDefaultHistoryPath(t *testing.T) {
+	path, err := DefaultHistoryPath("monkey")
+	if err != nil {
+		t.Skipf("no config dir: %v", err)
+	}
+
+	assert.True(t, strings.HasSuffix(path, filepath.Join("monkey", "history")), path)
+}
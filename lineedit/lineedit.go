@@ -0,0 +1,499 @@
+// Package lineedit reads lines from a terminal with Emacs style editing
+// keys, history recall, reverse incremental search and tab completion.
+//
+// The terminal is put in raw mode with termios ioctls for the duration of
+// each ReadLine, no cgo is involved. When the input is not a terminal
+// lines are read as they come, so piped input keeps working
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInterrupted is returned by ReadLine when Ctrl-C is pressed
+var ErrInterrupted = errors.New("lineedit: interrupted")
+
+// Completer returns the candidates for completing word, the identifier
+// ending at the cursor. Candidates not starting with word are ignored
+type Completer func(word string) []string
+
+// Editor reads lines from its input. History and Complete may be changed
+// between two calls of ReadLine
+type Editor struct {
+	History  *History
+	Complete Completer
+
+	in   *bufio.Reader
+	out  io.Writer
+	fd   int
+	term bool
+
+	// the line being edited
+	prompt string
+	buf    []rune
+	pos    int
+	cols   int
+
+	// histIndex is the history entry shown, History.Len() for the line
+	// being typed which is saved while browsing
+	histIndex int
+	saved     string
+}
+
+// New returns an Editor reading from in and drawing on out. Editing is only
+// enabled if both are terminals
+func New(in io.Reader, out io.Writer) *Editor {
+	e := &Editor{
+		History: NewHistory(DefaultHistorySize),
+		in:      bufio.NewReader(in),
+		out:     out,
+	}
+
+	inFile, ok1 := in.(*os.File)
+	outFile, ok2 := out.(*os.File)
+	if ok1 && ok2 && isTerminal(int(inFile.Fd())) && isTerminal(int(outFile.Fd())) {
+		e.fd = int(inFile.Fd())
+		e.term = true
+	}
+
+	return e
+}
+
+// IsTerminal reports whether the editor reads from a terminal
+func (e *Editor) IsTerminal() bool {
+	return e.term
+}
+
+// ReadLine shows prompt and returns the line entered, without its line
+// ending. It returns io.EOF at the end of the input or on Ctrl-D on an
+// empty line, and ErrInterrupted on Ctrl-C. Lines read from a terminal are
+// added to the history
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if !e.term {
+		return e.readPlain(prompt)
+	}
+
+	state, err := makeRaw(e.fd)
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	defer restore(e.fd, state)
+
+	e.cols = width(e.fd)
+	line, err := e.edit(prompt)
+	if err == nil {
+		// failing to persist the history must not stop the session
+		_ = e.History.Add(line)
+	}
+
+	return line, err
+}
+
+func (e *Editor) readPlain(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+
+	line, err := e.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+const esc = 0x1b
+
+func ctrl(r rune) rune {
+	return r & 0x1f
+}
+
+// keys without a character of their own
+const (
+	keyUnknown rune = -(iota + 1)
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+)
+
+// readKey reads a character or decodes an escape sequence
+func (e *Editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != esc {
+		return r, err
+	}
+
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+
+	switch r {
+	case 'O':
+		r, _, err = e.in.ReadRune()
+		switch r {
+		case 'H':
+			return keyHome, err
+		case 'F':
+			return keyEnd, err
+		}
+		return keyUnknown, err
+	case '[':
+	default:
+		return keyUnknown, nil // Alt and a key
+	}
+
+	// CSI: parameters then a final byte between @ and ~
+	var param strings.Builder
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+		param.WriteRune(r)
+	}
+
+	switch r {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	case '~':
+		switch param.String() {
+		case "1", "7":
+			return keyHome, nil
+		case "4", "8":
+			return keyEnd, nil
+		case "3":
+			return keyDelete, nil
+		}
+	}
+
+	return keyUnknown, nil
+}
+
+// edit runs the editing loop of a single line on a terminal in raw mode
+func (e *Editor) edit(prompt string) (string, error) {
+	e.prompt = prompt
+	e.buf = e.buf[:0]
+	e.pos = 0
+	e.histIndex = e.History.Len()
+	e.saved = ""
+	e.refresh()
+
+	for {
+		r, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		if r == ctrl('R') {
+			if r, err = e.search(); err != nil {
+				return "", err
+			}
+		}
+
+		switch r {
+		case '\r', '\n':
+			e.pos = len(e.buf)
+			e.refresh()
+			e.write("\r\n")
+			return string(e.buf), nil
+		case ctrl('C'):
+			e.write("^C\r\n")
+			return "", ErrInterrupted
+		case ctrl('D'):
+			if len(e.buf) == 0 {
+				e.write("\r\n")
+				return "", io.EOF
+			}
+			e.delete(e.pos, e.pos+1)
+		case 127, ctrl('H'):
+			e.delete(e.pos-1, e.pos)
+		case keyDelete:
+			e.delete(e.pos, e.pos+1)
+		case ctrl('A'), keyHome:
+			e.moveTo(0)
+		case ctrl('E'), keyEnd:
+			e.moveTo(len(e.buf))
+		case ctrl('B'), keyLeft:
+			e.moveTo(e.pos - 1)
+		case ctrl('F'), keyRight:
+			e.moveTo(e.pos + 1)
+		case ctrl('K'):
+			e.delete(e.pos, len(e.buf))
+		case ctrl('U'):
+			e.delete(0, e.pos)
+		case ctrl('W'):
+			start := e.pos
+			for start > 0 && e.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start-1] != ' ' {
+				start--
+			}
+			e.delete(start, e.pos)
+		case ctrl('L'):
+			e.write("\x1b[H\x1b[2J")
+			e.refresh()
+		case ctrl('P'), keyUp:
+			e.historyMove(-1)
+		case ctrl('N'), keyDown:
+			e.historyMove(1)
+		case '\t':
+			e.complete()
+		case ctrl('G'):
+			// search cancelled
+		default:
+			if r >= ' ' && unicode.IsPrint(r) {
+				e.insert([]rune{r})
+			}
+		}
+	}
+}
+
+func (e *Editor) write(s string) {
+	io.WriteString(e.out, s)
+}
+
+func (e *Editor) bell() {
+	e.write("\a")
+}
+
+func (e *Editor) insert(rs []rune) {
+	buf := make([]rune, 0, len(e.buf)+len(rs))
+	buf = append(buf, e.buf[:e.pos]...)
+	buf = append(buf, rs...)
+	buf = append(buf, e.buf[e.pos:]...)
+	e.buf = buf
+	e.pos += len(rs)
+	e.refresh()
+}
+
+// delete removes the runes between from and to, clamped to the line
+func (e *Editor) delete(from, to int) {
+	if from < 0 {
+		from = 0
+	}
+	if to > len(e.buf) {
+		to = len(e.buf)
+	}
+	if from >= to {
+		return
+	}
+
+	e.buf = append(e.buf[:from], e.buf[to:]...)
+	if e.pos > to {
+		e.pos -= to - from
+	} else if e.pos > from {
+		e.pos = from
+	}
+	e.refresh()
+}
+
+func (e *Editor) moveTo(pos int) {
+	if pos < 0 || pos > len(e.buf) {
+		return
+	}
+	e.pos = pos
+	e.refresh()
+}
+
+func (e *Editor) setLine(line string) {
+	e.buf = []rune(line)
+	e.pos = len(e.buf)
+	e.refresh()
+}
+
+// refresh redraws the line. A line wider than the terminal scrolls
+// horizontally to keep the cursor visible
+func (e *Editor) refresh() {
+	promptWidth := utf8.RuneCountInString(e.prompt)
+	start, end := 0, len(e.buf)
+	if e.cols > promptWidth {
+		for promptWidth+e.pos-start >= e.cols {
+			start++
+		}
+		for promptWidth+end-start > e.cols {
+			end--
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\r")
+	b.WriteString(e.prompt)
+	b.WriteString(string(e.buf[start:end]))
+	b.WriteString("\x1b[0K\r")
+	if col := promptWidth + e.pos - start; col > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", col)
+	}
+	e.write(b.String())
+}
+
+// historyMove shows the entry delta steps away from the current one
+func (e *Editor) historyMove(delta int) {
+	i := e.histIndex + delta
+	if i < 0 || i > e.History.Len() {
+		e.bell()
+		return
+	}
+
+	if e.histIndex == e.History.Len() {
+		e.saved = string(e.buf)
+	}
+	e.histIndex = i
+
+	if i == e.History.Len() {
+		e.setLine(e.saved)
+	} else {
+		e.setLine(e.History.At(i))
+	}
+}
+
+// search runs a reverse incremental search through the history. It returns
+// the key that ended the search, which the caller still has to handle, or
+// ctrl('G') if the search was cancelled
+func (e *Editor) search() (rune, error) {
+	originalLine, originalPos := string(e.buf), e.pos
+	var query []rune
+	match := -1
+
+	for {
+		label := "reverse-i-search"
+		line := ""
+		if match >= 0 {
+			line = e.History.At(match)
+		} else if len(query) > 0 {
+			label = "failed reverse-i-search"
+		}
+		e.write(fmt.Sprintf("\r(%s)`%s': %s\x1b[0K", label, string(query), line))
+
+		r, err := e.readKey()
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case r == ctrl('R'):
+			from := e.History.Len()
+			if match >= 0 {
+				from = match
+			}
+			if m := e.History.Search(string(query), from); m >= 0 && len(query) > 0 {
+				match = m
+			} else {
+				e.bell()
+			}
+		case r == 127 || r == ctrl('H'):
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				match = -1
+				if len(query) > 0 {
+					match = e.History.Search(string(query), e.History.Len())
+				}
+			}
+		case r == ctrl('G') || r == ctrl('C'):
+			e.buf = []rune(originalLine)
+			e.pos = originalPos
+			e.refresh()
+			return ctrl('G'), nil
+		case r >= ' ' && unicode.IsPrint(r):
+			query = append(query, r)
+			from := e.History.Len()
+			if match >= 0 {
+				from = match + 1 // the current match may still do
+			}
+			if m := e.History.Search(string(query), from); m >= 0 {
+				match = m
+			} else {
+				match = -1
+			}
+		default:
+			if match >= 0 {
+				e.histIndex = match
+				e.buf = []rune(e.History.At(match))
+			} else {
+				e.buf = []rune(originalLine)
+			}
+			e.pos = len(e.buf)
+			e.refresh()
+			return r, nil
+		}
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// complete extends the word before the cursor with the longest prefix its
+// candidates share, or lists them when there is nothing to add
+func (e *Editor) complete() {
+	if e.Complete == nil {
+		return
+	}
+
+	start := e.pos
+	for start > 0 && isWordRune(e.buf[start-1]) {
+		start--
+	}
+	word := string(e.buf[start:e.pos])
+
+	var candidates []string
+	seen := map[string]bool{}
+	for _, c := range e.Complete(word) {
+		if strings.HasPrefix(c, word) && !seen[c] {
+			candidates = append(candidates, c)
+			seen[c] = true
+		}
+	}
+	sort.Strings(candidates)
+
+	if len(candidates) == 0 {
+		e.bell()
+		return
+	}
+
+	if prefix := commonPrefix(candidates); len(prefix) > len(word) {
+		e.insert([]rune(prefix[len(word):]))
+		return
+	}
+
+	if len(candidates) > 1 {
+		e.write("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+		e.refresh()
+	}
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+
+	return prefix
+}
@@ -0,0 +1,200 @@
+package lineedit
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// editor returns an Editor reading keys as if the terminal was in raw mode
+func editor(keys string, history ...string) *Editor {
+	e := New(strings.NewReader(keys), &bytes.Buffer{})
+	e.in = bufio.NewReader(strings.NewReader(keys))
+	for _, line := range history {
+		e.History.Add(line)
+	}
+
+	return e
+}
+
+const (
+	up    = "\x1b[A"
+	down  = "\x1b[B"
+	right = "\x1b[C"
+	left  = "\x1b[D"
+	home  = "\x1b[H"
+	end   = "\x1bOF"
+	del   = "\x1b[3~"
+	bs    = "\x7f"
+)
+
+func TestEditing(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"let x = 1;\r", "let x = 1;"},
+		{"abc\n", "abc"},
+		{"ac" + left + "b\r", "abc"},
+		{"ac\x02b\r", "abc"},
+		{"bc" + home + "a" + end + "d\r", "abcd"},
+		{"bc\x01a\x05d\r", "abcd"},
+		{"abc" + left + left + right + "X\r", "abXc"},
+		{"abc" + bs + "\r", "ab"},
+		{"abc\x08\x08\r", "a"},
+		{bs + "a\r", "a"},
+		{"abc" + home + del + "\r", "bc"},
+		{"abc\x01\x04\r", "bc"},
+		{"abc" + left + "\x0b\r", "ab"},
+		{"abc" + left + "\x15\r", "c"},
+		{"let foo  bar\x17\r", "let foo  "},
+		{"let foo  \x17\r", "let "},
+		{"héllo" + left + left + left + bs + "e\r", "hello"},
+		{"a\x1bxb\r", "ab"},
+		{"a\tb\r", "ab"},
+	}
+
+	for _, tt := range tests {
+		line, err := editor(tt.keys).edit(">> ")
+		assert.NoError(t, err, "%q", tt.keys)
+		assert.Equal(t, tt.expected, line, "%q", tt.keys)
+	}
+}
+
+func TestEditingEnds(t *testing.T) {
+	_, err := editor("\x04").edit(">> ")
+	assert.Equal(t, io.EOF, err, "Ctrl-D on an empty line")
+
+	_, err = editor("abc\x03").edit(">> ")
+	assert.Equal(t, ErrInterrupted, err, "Ctrl-C")
+
+	_, err = editor("abc").edit(">> ")
+	assert.Equal(t, io.EOF, err, "end of input")
+}
+
+func TestHistoryRecall(t *testing.T) {
+	history := []string{"let a = 1;", "a + 1"}
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{up + "\r", "a + 1"},
+		{up + up + "\r", "let a = 1;"},
+		{up + up + up + "\r", "let a = 1;"},
+		{"\x10\x10\x0e\r", "a + 1"},
+		{"typed" + up + down + "\r", "typed"},
+		{up + " * 2\r", "a + 1 * 2"},
+	}
+
+	for _, tt := range tests {
+		line, err := editor(tt.keys, history...).edit(">> ")
+		assert.NoError(t, err, "%q", tt.keys)
+		assert.Equal(t, tt.expected, line, "%q", tt.keys)
+	}
+}
+
+func TestReverseSearch(t *testing.T) {
+	history := []string{"let add = fn(a, b) { a + b };", "let x = 1;", "add(x, 2)", "puts(x)"}
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"\x12add\r", "add(x, 2)"},
+		{"\x12add\x12\r", "let add = fn(a, b) { a + b };"},
+		{"\x12add\x12\x12\r", "let add = fn(a, b) { a + b };"},
+		{"\x12x\r", "puts(x)"},
+		{"\x12x\x12\r", "add(x, 2)"},
+		{"\x12let x\r", "let x = 1;"},
+		{"\x12addd" + bs + "\r", "add(x, 2)"},
+		{"draft\x12add\x07\r", "draft"},
+		{"draft\x12nothing\r", "draft"},
+		{"\x12puts" + home + "\x0b\r", ""},
+		{"\x12puts\x05 + 1\r", "puts(x) + 1"},
+		{"\x12let" + up + "\r", "let add = fn(a, b) { a + b };"},
+	}
+
+	for _, tt := range tests {
+		line, err := editor(tt.keys, history...).edit(">> ")
+		assert.NoError(t, err, "%q", tt.keys)
+		assert.Equal(t, tt.expected, line, "%q", tt.keys)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	words := []string{"let", "letter", "fn", "false", "first"}
+	complete := func(word string) []string { return words }
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"l\t\r", "let"},
+		{"let\t\t\r", "let"},
+		{"lett\t\r", "letter"},
+		{"x = f\t\r", "x = f"},
+		{"x = fi\t(1)\r", "x = first(1)"},
+		{"q\t\r", "q"},
+		{"(fn\t)\r", "(fn)"},
+		{"ab" + left + "\t\r", "ab"},
+	}
+
+	for _, tt := range tests {
+		e := editor(tt.keys)
+		e.Complete = complete
+		line, err := e.edit(">> ")
+		assert.NoError(t, err, "%q", tt.keys)
+		assert.Equal(t, tt.expected, line, "%q", tt.keys)
+	}
+}
+
+func TestCompletionListsCandidates(t *testing.T) {
+	var out bytes.Buffer
+	e := editor("f\t\r")
+	e.out = &out
+	e.Complete = func(word string) []string { return []string{"fn", "false", "first", "let"} }
+
+	_, err := e.edit(">> ")
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "\r\nfalse  first  fn\r\n")
+}
+
+func TestRefreshScrolls(t *testing.T) {
+	var out bytes.Buffer
+	e := editor("")
+	e.out = &out
+	e.cols = 10
+	e.prompt = ">> "
+	e.buf = []rune("abcdefghij")
+	e.pos = len(e.buf)
+
+	e.refresh()
+	assert.Equal(t, "\r>> efghij\x1b[0K\r\x1b[9C", out.String())
+
+	out.Reset()
+	e.pos = 0
+	e.refresh()
+	assert.Equal(t, "\r>> abcdefg\x1b[0K\r\x1b[3C", out.String())
+}
+
+func TestReadLineWithoutTerminal(t *testing.T) {
+	var out bytes.Buffer
+	e := New(strings.NewReader("first\r\nsecond\nlast"), &out)
+	assert.False(t, e.IsTerminal())
+
+	for _, expected := range []string{"first", "second", "last"} {
+		line, err := e.ReadLine("> ")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, line)
+	}
+
+	_, err := e.ReadLine("> ")
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "> > > > ", out.String())
+	assert.Equal(t, 0, e.History.Len(), "only terminal input is remembered")
+}
@@ -0,0 +1,20 @@
+//go:build !darwin && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!freebsd,!linux,!netbsd,!openbsd
+
+package lineedit
+
+import "errors"
+
+// Line editing needs a Unix terminal, elsewhere input is read line by line
+
+type termState struct{}
+
+func isTerminal(fd int) bool { return false }
+
+func makeRaw(fd int) (*termState, error) {
+	return nil, errors.New("lineedit: raw mode not supported on this platform")
+}
+
+func restore(fd int, state *termState) error { return nil }
+
+func width(fd int) int { return 0 }
@@ -1,20 +1,37 @@
+// Monkey_interpreter is the original entry point of the module, kept so
+// that go run . still works. It takes the same arguments as cmd/monkey,
+// which it runs, and also the older flag
+//
+//	-dump-ast file
+//
+// which is now spelled monkey ast file.
 package main
 
 import (
-	"fmt"
 	"os"
-	"os/user"
+	"strings"
 
-	"github.com/rsb/monkey_interpreter/repl"
+	"github.com/rsb/monkey_interpreter/internal/cli"
 )
 
 func main() {
-	user, err := user.Current()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%+v\n", err)
+	os.Exit(cli.Run(legacyArgs(os.Args[1:]), os.Stdin, os.Stdout, os.Stderr))
+}
+
+// legacyArgs rewrites the flags of the former command line as commands
+func legacyArgs(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+
+	for _, name := range []string{"-dump-ast", "--dump-ast"} {
+		if args[0] == name {
+			return append([]string{"ast"}, args[1:]...)
+		}
+		if value := strings.TrimPrefix(args[0], name+"="); value != args[0] {
+			return append([]string{"ast", value}, args[1:]...)
+		}
 	}
 
-	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
-	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	return args
 }
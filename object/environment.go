@@ -0,0 +1,51 @@
+package object
+
+import "sort"
+
+// Environment holds the bindings created by let statements. An enclosed
+// environment falls back to its outer environment when a name is not
+// bound locally
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+}
+
+// NewEnvironment constructor used to create an empty top level environment
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object)}
+}
+
+// NewEnclosedEnvironment creates an environment whose lookups fall back to outer
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// Get resolves name in this environment or any of its outer environments
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+
+	return obj, ok
+}
+
+// Set binds name to val in this environment
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
+
+// Names returns the names bound in this environment, without those of its
+// outer environments, in sorted order
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,336 @@
+// Package optimize simplifies programs before they are run.
+//
+// Operators applied to literals are folded into the literal they evaluate
+// to, on integers, booleans and strings, and arithmetic identities such as
+// x * 1 or x + 0 are removed. Only rewrites that cannot change the result
+// of the program are made: an expression that fails at run time, like a
+// division by zero or an operator applied to the wrong types, is kept as
+// is so that it still fails.
+//
+// Identities are only removed when the type of their operand is known
+// without running the program, from its literals and operators: x * 1,
+// x / 1 and x - 0 need a number, x + 0 an integer since -0.0 + 0 is 0.0.
+// A variable can hold any value, "a" * 1 is an error and "a" + 0 too, so
+// let a = 3; a * 1 is left as is.
+package optimize
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/format"
+	"github.com/rsb/monkey_interpreter/token"
+)
+
+// Change records a rewrite: the expression Before found at Pos was replaced
+// by After. Operands are simplified before the expression using them, so
+// Before shows them simplified already
+type Change struct {
+	Pos    token.Position
+	Before string
+	After  string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s => %s", c.Pos, c.Before, c.After)
+}
+
+// Optimize simplifies the tree rooted at node in place. It returns the
+// root, which is only replaced if it is itself simplified, and the changes
+// made, in the order they were made
+func Optimize(node ast.Node) (ast.Node, []Change) {
+	var changes []Change
+
+	node = ast.Modify(node, func(n ast.Node) ast.Node {
+		e, ok := n.(ast.Expression)
+		if !ok {
+			return n
+		}
+
+		simplified := simplify(e)
+		if simplified != e {
+			changes = append(changes, Change{Pos: e.Pos(), Before: format.String(e), After: format.String(simplified)})
+		}
+
+		return simplified
+	})
+
+	return node, changes
+}
+
+// simplify returns the simplest expression equivalent to e, whose operands
+// are simplified already
+func simplify(e ast.Expression) ast.Expression {
+	switch e := e.(type) {
+	case *ast.PrefixExpression:
+		if folded := foldPrefix(e); folded != nil {
+			return folded
+		}
+	case *ast.InfixExpression:
+		if folded := foldInfix(e); folded != nil {
+			return folded
+		}
+		if operand := identity(e); operand != nil {
+			return operand
+		}
+	case *ast.LogicalExpression:
+		if folded := foldLogical(e); folded != nil {
+			return folded
+		}
+	}
+
+	return e
+}
+
+// constant returns the value of a literal as an int64, a bool or a string
+func constant(e ast.Expression) (interface{}, bool) {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return e.Value, true
+	case *ast.Boolean:
+		return e.Value, true
+	case *ast.StringLiteral:
+		return e.Value, true
+	}
+
+	return nil, false
+}
+
+// literal builds the literal for value, positioned like the expression it
+// replaces
+func literal(value interface{}, replaced ast.Expression) ast.Expression {
+	tok := token.Token{Pos: replaced.Pos(), End: replaced.End()}
+
+	switch value := value.(type) {
+	case int64:
+		tok.Type, tok.Literal = token.INT, strconv.FormatInt(value, 10)
+		return &ast.IntegerLiteral{Token: tok, Value: value}
+	case bool:
+		tok.Type, tok.Literal = token.FALSE, "false"
+		if value {
+			tok.Type, tok.Literal = token.TRUE, "true"
+		}
+		return &ast.Boolean{Token: tok, Value: value}
+	case string:
+		tok.Type, tok.Literal = token.STRING, value
+		return &ast.StringLiteral{Token: tok, Value: value}
+	}
+
+	panic(fmt.Sprintf("optimize: no literal for %T", value))
+}
+
+// isTruthy is the truth value of a constant as the evaluator sees it
+func isTruthy(value interface{}) bool {
+	b, ok := value.(bool)
+	return !ok || b
+}
+
+func foldPrefix(e *ast.PrefixExpression) ast.Expression {
+	right, ok := constant(e.Right)
+	if !ok {
+		return nil
+	}
+
+	switch e.Operator {
+	case "!":
+		return literal(!isTruthy(right), e)
+	case "-":
+		if right, ok := right.(int64); ok {
+			return literal(-right, e)
+		}
+	}
+
+	return nil
+}
+
+func foldInfix(e *ast.InfixExpression) ast.Expression {
+	left, ok := constant(e.Left)
+	if !ok {
+		return nil
+	}
+	right, ok := constant(e.Right)
+	if !ok {
+		return nil
+	}
+
+	var value interface{}
+	switch left := left.(type) {
+	case int64:
+		if right, ok := right.(int64); ok {
+			value = foldIntegers(e.Operator, left, right)
+		}
+	case bool:
+		if right, ok := right.(bool); ok {
+			switch e.Operator {
+			case "==":
+				value = left == right
+			case "!=":
+				value = left != right
+			}
+		}
+	case string:
+		if right, ok := right.(string); ok {
+			switch e.Operator {
+			case "+":
+				value = left + right
+			case "==":
+				value = left == right
+			case "!=":
+				value = left != right
+			}
+		}
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	return literal(value, e)
+}
+
+// foldIntegers returns the value of left operator right, nil when it has
+// to fail at run time
+func foldIntegers(operator string, left, right int64) interface{} {
+	switch operator {
+	case "+":
+		return left + right
+	case "-":
+		return left - right
+	case "*":
+		return left * right
+	case "/":
+		if right != 0 {
+			return left / right
+		}
+	case "%":
+		if right != 0 {
+			return left % right
+		}
+	case "<":
+		return left < right
+	case ">":
+		return left > right
+	case "<=":
+		return left <= right
+	case ">=":
+		return left >= right
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	}
+
+	return nil
+}
+
+// foldLogical folds a logical expression whose left operand decides the
+// result, or whose operands are both constant. The result is a boolean
+// like the evaluator's
+func foldLogical(e *ast.LogicalExpression) ast.Expression {
+	left, ok := constant(e.Left)
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case e.Operator == "&&" && !isTruthy(left):
+		return literal(false, e)
+	case e.Operator == "||" && isTruthy(left):
+		return literal(true, e)
+	}
+
+	right, ok := constant(e.Right)
+	if !ok {
+		return nil
+	}
+
+	return literal(isTruthy(right), e)
+}
+
+// kind is what is statically known about the value of an expression
+type kind int
+
+const (
+	// unknown can be any value
+	unknown kind = iota
+	// number is an integer or a float, unless evaluating it fails
+	number
+	// integer is an integer, unless evaluating it fails
+	integer
+)
+
+func kindOf(e ast.Expression) kind {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return integer
+	case *ast.FloatLiteral:
+		return number
+	case *ast.PrefixExpression:
+		// negating anything but a number fails
+		if e.Operator == "-" {
+			if kindOf(e.Right) == integer {
+				return integer
+			}
+			return number
+		}
+	case *ast.InfixExpression:
+		left, right := kindOf(e.Left), kindOf(e.Right)
+		switch e.Operator {
+		case "-", "*", "/", "%":
+			// only defined on numbers
+			if left == integer && right == integer {
+				return integer
+			}
+			return number
+		case "+":
+			// strings can be added too
+			if left == unknown || right == unknown {
+				return unknown
+			}
+			if left == integer && right == integer {
+				return integer
+			}
+			return number
+		}
+	}
+
+	return unknown
+}
+
+func isInteger(e ast.Expression, value int64) bool {
+	i, ok := e.(*ast.IntegerLiteral)
+	return ok && i.Value == value
+}
+
+// identity returns the operand e reduces to if it is an arithmetic
+// identity. Adding zero keeps floats as they are but for -0, so it is only
+// removed from integers
+func identity(e *ast.InfixExpression) ast.Expression {
+	switch e.Operator {
+	case "*":
+		if isInteger(e.Right, 1) && kindOf(e.Left) >= number {
+			return e.Left
+		}
+		if isInteger(e.Left, 1) && kindOf(e.Right) >= number {
+			return e.Right
+		}
+	case "/":
+		if isInteger(e.Right, 1) && kindOf(e.Left) >= number {
+			return e.Left
+		}
+	case "-":
+		if isInteger(e.Right, 0) && kindOf(e.Left) >= number {
+			return e.Left
+		}
+	case "+":
+		if isInteger(e.Right, 0) && kindOf(e.Left) == integer {
+			return e.Left
+		}
+		if isInteger(e.Left, 0) && kindOf(e.Right) == integer {
+			return e.Right
+		}
+	}
+
+	return nil
+}
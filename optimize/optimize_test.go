@@ -0,0 +1,167 @@
+package optimize_test
+
+import (
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/evaluator"
+	"github.com/rsb/monkey_interpreter/format"
+	"github.com/rsb/monkey_interpreter/lexer"
+	"github.com/rsb/monkey_interpreter/object"
+	"github.com/rsb/monkey_interpreter/optimize"
+	"github.com/rsb/monkey_interpreter/parser"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	return program
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// folding
+		{"1 + 2 * 3", "7;\n"},
+		{"60 * 60 * 24", "86400;\n"},
+		{"7 / 2; 7 % 2", "3;\n1;\n"},
+		{"-(2 + 3)", "-5;\n"},
+		{"x - -(1 + 1)", "x - -2;\n"},
+		{"-(1 - 3)[0]", "-(-2)[0];\n"},
+		{"-(0 - 3) + -(-x)", "3 + -(-x);\n"},
+		{"-(1 - 4) * y; -(-(1 + 2) - x)", "3 * y;\n-(-3 - x);\n"},
+		{"-(-(x * 1))", "-(-(x * 1));\n"},
+		{"-(-(-x * 1))", "-(-(-x));\n"},
+		{"1 < 2; 2 >= 3; 1 == 1; 1 != 1", "true;\nfalse;\ntrue;\nfalse;\n"},
+		{"!true; !!false; !5; !\"\"", "false;\nfalse;\nfalse;\nfalse;\n"},
+		{"true == false; true != false", "false;\ntrue;\n"},
+		{`"foo" + "bar"; "a" == "a"; "a" != "a"`, "\"foobar\";\ntrue;\nfalse;\n"},
+		{"false && f(); true || f()", "false;\ntrue;\n"},
+		{"true && 1; false || false", "true;\nfalse;\n"},
+		{"if (1 > 2) { 10 } else { 2 * 10 }", "if (false) { 10 } else { 20 }\n"},
+		{"let f = fn(x) { x + 60 * 60 };", "let f = fn(x) { x + 3600 };\n"},
+		{"[1 + 1, {\"a\" + \"b\": 2 * 2}]", "[2, {\"ab\": 4}];\n"},
+		// failing at run time
+		{"1 / 0; 1 % (1 - 1)", "1 / 0;\n1 % 0;\n"},
+		{"1 + true; \"a\" - \"b\"; true + true; \"a\" < \"b\"", "1 + true;\n\"a\" - \"b\";\ntrue + true;\n\"a\" < \"b\";\n"},
+		{"-true; -\"a\"", "-true;\n-\"a\";\n"},
+		// not constant
+		{"1.5 + 1.5", "1.5 + 1.5;\n"},
+		{"x && true; true && x", "x && true;\ntrue && x;\n"},
+		// identities
+		{"-x * 1; 1 * -x; -x / 1; -x - 0", "-x;\n-x;\n-x;\n-x;\n"},
+		{"(x - y) * 1", "x - y;\n"},
+		{"(1 / 0) + 0; 0 + -(1 % 0)", "1 / 0;\n-(1 % 0);\n"},
+		{"2.5 * 1", "2.5;\n"},
+		{"x * (3 - 2)", "x * 1;\n"},
+		// the type of a variable is not known, it may be a string
+		{"let a = 3; a * 1; a + 0; 1 * a; a / 1", "let a = 3;\na * 1;\na + 0;\n1 * a;\na / 1;\n"},
+		{"x * 1; x + 0; x - 0", "x * 1;\nx + 0;\nx - 0;\n"},
+		{"-x + 0; (x - y) + 0; (x % 2) + 0", "-x + 0;\nx - y + 0;\nx % 2 + 0;\n"},
+		{"\"a\" * 1; [1] + 0; (a + b) * 1", "\"a\" * 1;\n[1] + 0;\n(a + b) * 1;\n"},
+		{"(1 / 0) * 1", "1 / 0;\n"},
+		{"x * 0; 0 / x; 1 / x", "x * 0;\n0 / x;\n1 / x;\n"},
+	}
+
+	for _, tt := range tests {
+		node, _ := optimize.Optimize(parse(t, tt.input))
+		assert.Equal(t, tt.expected, format.String(node), tt.input)
+	}
+}
+
+func TestOptimizeExpression(t *testing.T) {
+	program := parse(t, "1 + 2")
+	expr := program.Statements[0].(*ast.ExpressionStatment).Expression
+
+	node, changes := optimize.Optimize(expr)
+	if assert.IsType(t, &ast.IntegerLiteral{}, node) {
+		assert.Equal(t, int64(3), node.(*ast.IntegerLiteral).Value)
+		assert.Equal(t, "3", node.String())
+	}
+	assert.Len(t, changes, 1)
+}
+
+func TestChanges(t *testing.T) {
+	program := parse(t, "let day = 60 * 60 * 24;\nlet f = fn(x) { -x * 1 };\nx + 0")
+
+	_, changes := optimize.Optimize(program)
+
+	var lines []string
+	for _, c := range changes {
+		lines = append(lines, c.String())
+	}
+	assert.Equal(t, []string{
+		"1:11: 60 * 60 => 3600",
+		"1:11: 3600 * 24 => 86400",
+		"2:17: -x * 1 => -x",
+	}, lines)
+}
+
+func TestChangesNegation(t *testing.T) {
+	_, changes := optimize.Optimize(parse(t, "-(-(1 + 2))"))
+
+	var lines []string
+	for _, c := range changes {
+		lines = append(lines, c.String())
+	}
+	assert.Equal(t, []string{
+		"1:5: 1 + 2 => 3",
+		"1:3: -3 => -3",
+		"1:1: -(-3) => 3",
+	}, lines)
+}
+
+func TestPositions(t *testing.T) {
+	program := parse(t, "x;\n1 +\n2")
+
+	optimize.Optimize(program)
+
+	lit := program.Statements[1].(*ast.ExpressionStatment).Expression
+	assert.Equal(t, 2, lit.Pos().Line)
+	assert.Equal(t, 1, lit.Pos().Column)
+	assert.Equal(t, 3, lit.End().Line)
+}
+
+// TestSemantics checks that optimized programs evaluate to the same value
+// as the original ones
+func TestSemantics(t *testing.T) {
+	inputs := []string{
+		"1 + 2 * 3 - 4 / 2 % 3",
+		"let x = 5; x * 1 + 0 - 0",
+		"let x = 2.5; [x * 1, 1 * x, x / 1, x - 0, x + 0]",
+		"let x = -0.0; [x + 0, 0 + x, x - 0]",
+		"let f = fn(x) { (x - 1) * 1 }; f(3)",
+		"-(1 - 3)[0]",
+		"1 / 0",
+		"(2 % 0) * 1",
+		"let s = \"a\"; s * 1",
+		"let s = \"a\"; s + 0",
+		"-true * 1",
+		"\"a\" + \"b\" == \"ab\"",
+		"!(1 < 2) || !false",
+		"false && 1 / 0",
+		"true || 1 / 0",
+		"true && 0",
+		"if (1 == 1 && true) { 1 + 1 } else { 0 }",
+		"[1, 2, 3][2 - 1] * 1",
+		"-9223372036854775807 - 1",
+		"let m = -9223372036854775807 - 1; -m",
+	}
+
+	for _, input := range inputs {
+		want := evaluator.Eval(parse(t, input), object.NewEnvironment())
+		node, _ := optimize.Optimize(parse(t, input))
+		got := evaluator.Eval(node, object.NewEnvironment())
+
+		assert.Equal(t, want.Type(), got.Type(), input)
+		assert.Equal(t, want.Inspect(), got.Inspect(), input)
+	}
+}
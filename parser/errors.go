@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rsb/monkey_interpreter/token"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "Severity(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// Error is a single diagnostic produced while parsing. Pos and End delimit
+// the offending source range, Expected lists the token types the parser
+// would have accepted and Actual is the token it found instead
+type Error struct {
+	Pos      token.Position
+	End      token.Position
+	Expected []token.TokenType
+	Actual   token.Token
+	Message  string
+	Severity Severity
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Pos, e.Severity, e.Message)
+}
+
+// Render writes every diagnostic to w followed by the source line it refers
+// to, with the offending range underlined
+//
+//	error: expected next token to be =, got INT instead
+//	 --> script.mk:1:7
+//	  |
+//	1 | let x 5
+//	  |       ^
+func Render(w io.Writer, filename, src string, diags []*Error) error {
+	for _, d := range diags {
+		if _, err := io.WriteString(w, renderError(filename, src, d)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func renderError(filename, src string, d *Error) string {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "%s: %s\n", d.Severity, d.Message)
+
+	location := d.Pos.String()
+	if filename != "" {
+		location = filename + ":" + location
+	}
+	fmt.Fprintf(&out, " --> %s\n", location)
+
+	if !d.Pos.IsValid() || d.Pos.Offset > len(src) {
+		return out.String()
+	}
+
+	lineStart := strings.LastIndexByte(src[:d.Pos.Offset], '\n') + 1
+	lineEnd := len(src)
+	if i := strings.IndexByte(src[d.Pos.Offset:], '\n'); i >= 0 {
+		lineEnd = d.Pos.Offset + i
+	}
+	line := strings.TrimRight(src[lineStart:lineEnd], "\r")
+
+	gutter := strings.Repeat(" ", len(strconv.Itoa(d.Pos.Line)))
+	fmt.Fprintf(&out, "%s |\n", gutter)
+	fmt.Fprintf(&out, "%d | %s\n", d.Pos.Line, line)
+
+	// Keep tabs in the padding so the caret lines up with the source
+	// line however the terminal renders them
+	var padding bytes.Buffer
+	for _, r := range src[lineStart:d.Pos.Offset] {
+		if r == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+
+	width := 1
+	if d.End.Offset > d.Pos.Offset {
+		end := d.End.Offset
+		if end > lineEnd {
+			end = lineEnd
+		}
+		if n := utf8.RuneCountInString(src[d.Pos.Offset:end]); n > 1 {
+			width = n
+		}
+	}
+
+	fmt.Fprintf(&out, "%s | %s%s\n", gutter, padding.String(), strings.Repeat("^", width))
+
+	return out.String()
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/rsb/monkey_interpreter/ast"
 	"github.com/rsb/monkey_interpreter/lexer"
@@ -12,23 +13,33 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
+	token.OR:       LOGICAL_OR,
+	token.AND:      LOGICAL_AND,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LT_EQ:    LESSGREATER,
+	token.GT_EQ:    LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT:  PRODUCT,
+	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
 }
 
 type (
@@ -41,7 +52,24 @@ type Parser struct {
 
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    []*Error
+
+	// number of lexer errors already copied into errors
+	lexerErrors int
+
+	// maxErrors stops parsing once that many errors were reported, zero
+	// means no limit
+	maxErrors int
+
+	// panicking is set by the first error of a statement and suppresses
+	// follow-on errors until the parser resynchronises
+	panicking bool
+	stmtPos   token.Position
+
+	// prevToken and pending let the parser step back a single token, see
+	// backup
+	prevToken token.Token
+	pending   []token.Token
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -50,24 +78,40 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*Error{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.RegisterPrefix(token.IDENT, p.parseIdentifier)
 	p.RegisterPrefix(token.INT, p.parseIntegerLiteral)
+	p.RegisterPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.RegisterPrefix(token.STRING, p.parseStringLiteral)
 	p.RegisterPrefix(token.BANG, p.parsePrefixExpression)
 	p.RegisterPrefix(token.MINUS, p.parsePrefixExpression)
+	p.RegisterPrefix(token.TRUE, p.parseBoolean)
+	p.RegisterPrefix(token.FALSE, p.parseBoolean)
+	p.RegisterPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.RegisterPrefix(token.IF, p.parseIfExpression)
+	p.RegisterPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.RegisterPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.RegisterPrefix(token.LBRACE, p.parseHashLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.RegisterInfix(token.PLUS, p.parseInfixExpression)
 	p.RegisterInfix(token.MINUS, p.parseInfixExpression)
 	p.RegisterInfix(token.SLASH, p.parseInfixExpression)
 	p.RegisterInfix(token.ASTERISK, p.parseInfixExpression)
+	p.RegisterInfix(token.PERCENT, p.parseInfixExpression)
 	p.RegisterInfix(token.EQ, p.parseInfixExpression)
 	p.RegisterInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.RegisterInfix(token.LT, p.parseInfixExpression)
 	p.RegisterInfix(token.GT, p.parseInfixExpression)
+	p.RegisterInfix(token.LT_EQ, p.parseInfixExpression)
+	p.RegisterInfix(token.GT_EQ, p.parseInfixExpression)
+	p.RegisterInfix(token.AND, p.parseLogicalExpression)
+	p.RegisterInfix(token.OR, p.parseLogicalExpression)
+	p.RegisterInfix(token.LPAREN, p.parseCallExpression)
+	p.RegisterInfix(token.LBRACKET, p.parseIndexExpression)
 
 	// Read two token, so curToken and peekToken are both set
 	p.nextToken()
@@ -84,37 +128,92 @@ func (p *Parser) RegisterInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+// Errors returns the message of every diagnostic reported while parsing
 func (p *Parser) Errors() []string {
+	msgs := make([]string, 0, len(p.errors))
+	for _, e := range p.errors {
+		msgs = append(msgs, e.Message)
+	}
+
+	return msgs
+}
+
+// Diagnostics returns every error reported while parsing, in source order
+func (p *Parser) Diagnostics() []*Error {
 	return p.errors
 }
 
+// SetMaxErrors makes the parser give up once n errors were reported. Zero,
+// the default, means no limit
+func (p *Parser) SetMaxErrors(n int) {
+	p.maxErrors = n
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	program := ast.Program{}
 	program.Statements = []ast.Statement{}
 
-	for !p.curTokenIs(token.EOF) {
+	for !p.curTokenIs(token.EOF) && !p.tooManyErrors() {
 		stmt := p.parseStatement()
-		if stmt != nil {
-			program.Statements = append(program.Statements, stmt)
-		}
+		program.Statements = append(program.Statements, stmt)
 		p.nextToken()
 	}
 
 	return &program
 }
 
+// parseStatement never returns nil. When the statement reports an error the
+// rest of it is skipped and, if nothing usable was parsed, a BadStatement
+// takes its place
 func (p *Parser) parseStatement() ast.Statement {
+	start := p.curToken
+
+	// a statement nested in a block gets its own recovery, the enclosing
+	// statement's state is restored once it is parsed
+	outerPanicking, outerPos := p.panicking, p.stmtPos
+	p.panicking, p.stmtPos = false, start.Pos
+	defer func() { p.panicking, p.stmtPos = outerPanicking, outerPos }()
+
+	var stmt ast.Statement
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		stmt = p.parseLetStatement()
 	case token.RETURN:
-		return p.parseReturnStatement()
+		stmt = p.parseReturnStatement()
 	default:
-		return p.parseExpressionStatement()
+		stmt = p.parseExpressionStatement()
 	}
+
+	if !p.panicking {
+		return stmt
+	}
+
+	p.synchronize()
+	if stmt == nil {
+		stmt = &ast.BadStatement{Token: start, To: p.curToken}
+	}
+
+	return stmt
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+// synchronize skips the remainder of a statement that reported an error. It
+// stops on the semicolon ending the statement or right before the next let,
+// return or closing brace
+func (p *Parser) synchronize() {
+	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.EOF) {
+		switch p.peekToken.Type {
+		case token.LET, token.RETURN, token.RBRACE, token.EOF:
+			return
+		}
+		p.nextToken()
+	}
+}
+
+func (p *Parser) tooManyErrors() bool {
+	return p.maxErrors > 0 && len(p.errors) >= p.maxErrors
+}
+
+func (p *Parser) parseLetStatement() ast.Statement {
 	stmt := ast.LetStatement{Token: p.curToken}
 	if !p.expectPeek(token.IDENT) {
 		return nil
@@ -129,21 +228,23 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
 
-	// TODO: We're skipping the expression until we encounter a semicolon
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
 	return &stmt
 }
 
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+func (p *Parser) parseReturnStatement() ast.Statement {
 	stmt := ast.ReturnStatement{Token: p.curToken}
 
-	p.nextToken()
+	// A bare return has no value to parse
+	if !p.peekTokenIs(token.SEMICOLON) && !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+	}
 
-	// TODO: we are skipping the expression until we encounter a semicolon
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -163,14 +264,28 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatment {
 	return &stmt
 }
 
+// parseExpression never returns nil, an expression that fails to parse is
+// replaced by a BadExpression spanning the tokens consumed so far
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	start := p.curToken
 
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		bad := &ast.BadExpression{Token: start, To: p.curToken}
+
+		// A missing operand right before a closing delimiter, as in
+		// `f(x + )`, leaves the delimiter to the construct it belongs to
+		if isClosingDelimiter(p.curToken.Type) && p.curToken.Pos != p.stmtPos {
+			p.backup()
+		}
+
+		return bad
 	}
 	leftExpr := prefix()
+	if leftExpr == nil {
+		return &ast.BadExpression{Token: start, To: p.curToken}
+	}
 
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
@@ -179,6 +294,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		}
 		p.nextToken()
 		leftExpr = infix(leftExpr)
+		if leftExpr == nil {
+			return &ast.BadExpression{Token: start, To: p.curToken}
+		}
 	}
 
 	return leftExpr
@@ -211,6 +329,20 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expr
 }
 
+func (p *Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
+	expr := &ast.LogicalExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Left:     left,
+	}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+	expr.Right = p.parseExpression(precedence)
+
+	return expr
+}
+
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -218,10 +350,17 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := ast.IntegerLiteral{Token: p.curToken}
 
+	// base 0 would read a leading zero as a legacy octal prefix
+	if isLegacyOctal(p.curToken.Literal) {
+		msg := fmt.Sprintf("could not parse %q as integer: leading zero, use 0o for octal", p.curToken.Literal)
+		p.tokenError(p.curToken, msg)
+		return nil
+	}
+
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.tokenError(p.curToken, msg)
 		return nil
 	}
 	lit.Value = value
@@ -229,25 +368,304 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return &lit
 }
 
-func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
+// isLegacyOctal reports whether lit is a decimal integer with a leading zero
+func isLegacyOctal(lit string) bool {
+	return len(lit) > 1 && lit[0] == '0' && !strings.ContainsRune("xXoObB", rune(lit[1]))
+}
+
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+}
+
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	p.nextToken()
+
+	expr := p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
 	}
 
-	return LOWEST
+	return expr
 }
 
-func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
+func (p *Parser) parseIfExpression() ast.Expression {
+	expr := ast.IfExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expr.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expr.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expr.Alternative = p.parseBlockStatement()
+	}
+
+	return &expr
+}
+
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) && !p.tooManyErrors() {
+		block.Statements = append(block.Statements, p.parseStatement())
+		p.nextToken()
+	}
+
+	if p.curTokenIs(token.EOF) {
+		msg := fmt.Sprintf("expected next token to be %s, got %s instead", token.RBRACE, token.EOF)
+		p.tokenError(p.curToken, msg, token.RBRACE)
+	} else {
+		block.Rbrace = p.curToken
+	}
+
+	return &block
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return &lit
+}
+
+// parseFunctionParameters returns nil when the parameter list is malformed
+// and an empty slice when there are no parameters
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return identifiers
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return identifiers
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	expr := ast.CallExpression{Token: p.curToken, Function: function}
+
+	expr.Arguments = p.parseExpressionList(token.RPAREN)
+	if expr.Arguments == nil {
+		return nil
+	}
+	expr.Rparen = p.curToken
+
+	return &expr
+}
+
+// parseExpressionList parses comma separated expressions up to and
+// including the end token. It returns nil when the list is malformed and an
+// empty slice when there are no expressions
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := ast.ArrayLiteral{Token: p.curToken}
+
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+	array.Rbracket = p.curToken
+
+	return &array
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = []ast.HashPair{}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	hash.Rbrace = p.curToken
+
+	return &hash
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	expr := ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	expr.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	expr.Rbracket = p.curToken
+
+	return &expr
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
+		p.tokenError(p.curToken, msg)
+		return nil
+	}
+	lit.Value = value
+
+	return &lit
+}
+
+// Precedence returns the binding power of t as an infix operator, LOWEST if
+// t is not one
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
 		return p
 	}
 
 	return LOWEST
 }
 
+func (p *Parser) peekPrecedence() int {
+	return Precedence(p.peekToken.Type)
+}
+
+func (p *Parser) curPrecedence() int {
+	return Precedence(p.curToken.Type)
+}
+
 func (p *Parser) nextToken() {
+	p.prevToken = p.curToken
 	p.curToken = p.peekToken
+
+	if n := len(p.pending); n > 0 {
+		p.peekToken = p.pending[n-1]
+		p.pending = p.pending[:n-1]
+		return
+	}
+
 	p.peekToken = p.l.NextToken()
+
+	for _, e := range p.l.Errors()[p.lexerErrors:] {
+		if p.tooManyErrors() {
+			break
+		}
+		p.errors = append(p.errors, &Error{
+			Pos:      e.Pos,
+			End:      e.End,
+			Actual:   p.peekToken,
+			Message:  e.Message,
+			Severity: SeverityError,
+		})
+	}
+	p.lexerErrors = len(p.l.Errors())
+}
+
+// backup steps back one token, the current token becomes the peek token
+// again. It must not be called twice without advancing in between
+func (p *Parser) backup() {
+	p.pending = append(p.pending, p.peekToken)
+	p.peekToken = p.curToken
+	p.curToken = p.prevToken
+}
+
+func isClosingDelimiter(t token.TokenType) bool {
+	switch t {
+	case token.RPAREN, token.RBRACKET, token.RBRACE, token.SEMICOLON, token.COMMA, token.COLON, token.EOF:
+		return true
+	}
+
+	return false
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -269,10 +687,38 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.tokenError(p.curToken, msg)
 }
 
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.tokenError(p.peekToken, msg, t)
+}
+
+// tokenError records an error spanning tok, unless it follows an earlier
+// error of the same statement
+func (p *Parser) tokenError(tok token.Token, msg string, expected ...token.TokenType) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+
+	if p.tooManyErrors() {
+		return
+	}
+
+	// a token given back by backup may be reported again by the statement
+	// it is handed to
+	if n := len(p.errors); n > 0 && p.errors[n-1].Pos == tok.Pos && p.errors[n-1].Message == msg {
+		return
+	}
+
+	p.errors = append(p.errors, &Error{
+		Pos:      tok.Pos,
+		End:      tok.End,
+		Expected: expected,
+		Actual:   tok,
+		Message:  msg,
+		Severity: SeverityError,
+	})
 }
@@ -1,6 +1,7 @@
 package parser_test
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/rsb/monkey_interpreter/ast"
@@ -80,9 +81,8 @@ func TestLetStatementErrorNoIDENT(t *testing.T) {
 	assert.NotNil(program)
 	errList := p.Errors()
 
-	assert.Equal(2, len(errList))
+	assert.Equal(1, len(errList))
 	assert.Equal("expected next token to be IDENT, got = instead", errList[0])
-	assert.Equal("no prefix parse function for = found", errList[1])
 }
 func TestThreeReturnStatements(t *testing.T) {
 	assert := assert.New(t)
@@ -213,6 +213,9 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5", 5, "<", 5},
 		{"5 == 5", 5, "==", 5},
 		{"5 != 5", 5, "!=", 5},
+		{"5 % 5", 5, "%", 5},
+		{"5 <= 5", 5, "<=", 5},
+		{"5 >= 5", 5, ">=", 5},
 	}
 
 	for _, tt := range infixTests {
@@ -285,6 +288,90 @@ func TestParseProgram_OperatorPrecendence(t *testing.T) {
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
 		},
+		{
+			"true",
+			"true",
+		},
+		{
+			"false",
+			"false",
+		},
+		{
+			"3 > 5 == false",
+			"((3 > 5) == false)",
+		},
+		{
+			"3 < 5 == true",
+			"((3 < 5) == true)",
+		},
+		{
+			"1 + (2 + 3) + 4",
+			"((1 + (2 + 3)) + 4)",
+		},
+		{
+			"(5 + 5) * 2",
+			"((5 + 5) * 2)",
+		},
+		{
+			"2 / (5 + 5)",
+			"(2 / (5 + 5))",
+		},
+		{
+			"-(5 + 5)",
+			"(-(5 + 5))",
+		},
+		{
+			"!(true == true)",
+			"(!(true == true))",
+		},
+		{
+			"a + add(b * c) + d",
+			"((a + add((b * c))) + d)",
+		},
+		{
+			"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+			"add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))",
+		},
+		{
+			"add(a + b + c * d / f + g)",
+			"add((((a + b) + ((c * d) / f)) + g))",
+		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"fns[0](x)",
+			"(fns[0])(x)",
+		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == b && c != d || !e",
+			"(((a == b) && (c != d)) || (!e))",
+		},
+		{
+			"a || b || c",
+			"((a || b) || c)",
+		},
 	}
 
 	for _, tt := range infixTests {
@@ -296,3 +383,811 @@ func TestParseProgram_OperatorPrecendence(t *testing.T) {
 		assert.Equal(tt.expected, actual)
 	}
 }
+
+func TestNodePositions(t *testing.T) {
+	assert := assert.New(t)
+
+	input := "let x = 5;\nreturn 1;\n-a * 10;"
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	tests := []struct {
+		node          ast.Node
+		expectedPos   string
+		expectedEnd   string
+		expectedRange string
+	}{
+		{program, "1:1", "3:8", "let x = 5;\nreturn 1;\n-a * 10"},
+		{program.Statements[0], "1:1", "1:10", "let x = 5"},
+		{program.Statements[0].(*ast.LetStatement).Name, "1:5", "1:6", "x"},
+		{program.Statements[2], "3:1", "3:8", "-a * 10"},
+		{program.Statements[2].(*ast.ExpressionStatment).Expression, "3:1", "3:8", "-a * 10"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(tt.expectedPos, tt.node.Pos().String())
+		assert.Equal(tt.expectedEnd, tt.node.End().String())
+		assert.Equal(tt.expectedRange, input[tt.node.Pos().Offset:tt.node.End().Offset])
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	assert := assert.New(t)
+
+	input := "let x = 1;\nlet y 5;"
+	l := lexer.New(input)
+	p := parser.New(l)
+	p.ParseProgram()
+
+	diags := p.Diagnostics()
+	assert.Len(diags, 1)
+
+	d := diags[0]
+	assert.Equal(parser.SeverityError, d.Severity)
+	assert.Equal("expected next token to be =, got INT instead", d.Message)
+	assert.Equal([]token.TokenType{token.ASSIGN}, d.Expected)
+	assert.Equal(token.TokenType(token.INT), d.Actual.Type)
+	assert.Equal("5", d.Actual.Literal)
+	assert.Equal("2:7", d.Pos.String())
+	assert.Equal("2:8", d.End.String())
+	assert.Equal("2:7: error: expected next token to be =, got INT instead", d.Error())
+}
+
+func TestRenderDiagnostics(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = 1;\nlet y 500;",
+			"error: expected next token to be =, got INT instead\n" +
+				" --> script.mk:2:7\n" +
+				"  |\n" +
+				"2 | let y 500;\n" +
+				"  |       ^^^\n",
+		},
+		{
+			"let größe 1",
+			"error: expected next token to be =, got INT instead\n" +
+				" --> script.mk:1:11\n" +
+				"  |\n" +
+				"1 | let größe 1\n" +
+				"  |           ^\n",
+		},
+		{
+			"\tlet = 1;\nlet y 2",
+			"error: expected next token to be IDENT, got = instead\n" +
+				" --> script.mk:1:6\n" +
+				"  |\n" +
+				"1 | \tlet = 1;\n" +
+				"  | \t    ^\n" +
+				"error: expected next token to be =, got INT instead\n" +
+				" --> script.mk:2:7\n" +
+				"  |\n" +
+				"2 | let y 2\n" +
+				"  |       ^\n",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		p.ParseProgram()
+
+		var out bytes.Buffer
+		err := parser.Render(&out, "script.mk", tt.input, p.Diagnostics())
+		assert.NoError(err)
+		assert.Equal(tt.expected, out.String())
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"return 5;", 5},
+		{"return 10", 10},
+		{"return foobar;", "foobar"},
+		{"return y", "y"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		assert.Len(program.Statements, 1, "program should only have 1 statement")
+
+		stmt, ok := program.Statements[0].(*ast.ReturnStatement)
+		assert.True(ok, "stmt is not *ast.ReturnStatement, got=%T", program.Statements[0])
+		assert.Equal("return", stmt.TokenLiteral())
+		testLiteralExpression(t, stmt.Value, tt.expectedValue)
+	}
+}
+
+func TestBareReturnStatement(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, input := range []string{"return;", "return"} {
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		assert.Len(program.Statements, 1, "program should only have 1 statement")
+
+		stmt, ok := program.Statements[0].(*ast.ReturnStatement)
+		assert.True(ok, "stmt is not *ast.ReturnStatement, got=%T", program.Statements[0])
+		assert.Nil(stmt.Value)
+		assert.Equal("return ;", stmt.String())
+	}
+}
+
+func TestStatementsWithoutSemicolons(t *testing.T) {
+	assert := assert.New(t)
+
+	input := `let x = 5
+	let y = x * 2
+	return x + y`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	assert.Equal("let x = 5;let y = (x * 2);return (x + y);", program.String())
+}
+
+func TestMalformedLetAndReturnStatements(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		input          string
+		expectedErrors []string
+	}{
+		{"let", []string{"expected next token to be IDENT, got EOF instead"}},
+		{"let x", []string{"expected next token to be =, got EOF instead"}},
+		{"let x =", []string{"no prefix parse function for EOF found"}},
+		{"let x = ;", []string{"no prefix parse function for ; found"}},
+		{"let 5 = 5;", []string{"expected next token to be IDENT, got INT instead"}},
+		{"return =", []string{"no prefix parse function for = found"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		assert.NotNil(program)
+
+		errs := p.Errors()
+		assert.NotEmpty(errs, "expected errors for %q", tt.input)
+		if len(errs) > 0 {
+			assert.Equal(tt.expectedErrors[0], errs[0], "first error for %q", tt.input)
+		}
+
+		for _, stmt := range program.Statements {
+			assert.NotNil(stmt, "program for %q contains a nil statement", tt.input)
+		}
+	}
+}
+
+func TestBooleanExpression(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true;", true},
+		{"false;", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		assert.Len(program.Statements, 1, "program should have 1 statement got %d", len(program.Statements))
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatment)
+		assert.True(ok, "stmt is not *ast.ExpressionStatement got=%T", program.Statements[0])
+		testBooleanLiteral(t, stmt.Expression, tt.expected)
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	assert := assert.New(t)
+	input := `if (x < y) { x }`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	assert.Len(program.Statements, 1, "program should have 1 statement got %d", len(program.Statements))
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatment)
+	assert.True(ok, "stmt is not *ast.ExpressionStatement got=%T", program.Statements[0])
+
+	expr, ok := stmt.Expression.(*ast.IfExpression)
+	assert.True(ok, "stmt.Expression is not *ast.IfExpression got=%T", stmt.Expression)
+
+	testInfixExpression(t, expr.Condition, "x", "<", "y")
+	assert.Len(expr.Consequence.Statements, 1)
+
+	consequence, ok := expr.Consequence.Statements[0].(*ast.ExpressionStatment)
+	assert.True(ok, "consequence is not *ast.ExpressionStatement got=%T", expr.Consequence.Statements[0])
+	testIdentifier(t, consequence.Expression, "x")
+	assert.Nil(expr.Alternative)
+
+	assert.Equal("if(x < y) x", program.String())
+	assert.Equal(len(input), expr.End().Offset)
+}
+
+func TestIfElseExpression(t *testing.T) {
+	assert := assert.New(t)
+	input := `if (x < y) { x } else { return y; }`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	assert.Len(program.Statements, 1, "program should have 1 statement got %d", len(program.Statements))
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatment)
+	assert.True(ok, "stmt is not *ast.ExpressionStatement got=%T", program.Statements[0])
+
+	expr, ok := stmt.Expression.(*ast.IfExpression)
+	assert.True(ok, "stmt.Expression is not *ast.IfExpression got=%T", stmt.Expression)
+
+	testInfixExpression(t, expr.Condition, "x", "<", "y")
+	assert.Len(expr.Consequence.Statements, 1)
+	assert.Len(expr.Alternative.Statements, 1)
+
+	alternative, ok := expr.Alternative.Statements[0].(*ast.ReturnStatement)
+	assert.True(ok, "alternative is not *ast.ReturnStatement got=%T", expr.Alternative.Statements[0])
+	testIdentifier(t, alternative.Value, "y")
+
+	assert.Equal("if(x < y) xelse return y;", program.String())
+}
+
+func TestMalformedIfExpressions(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"if x < y { x }", "expected next token to be (, got IDENT instead"},
+		{"if (x < y { x }", "expected next token to be ), got { instead"},
+		{"if (x < y) x", "expected next token to be {, got IDENT instead"},
+		{"if (x < y) { x } else y", "expected next token to be {, got IDENT instead"},
+		{"if (x < y) { x", "expected next token to be }, got EOF instead"},
+		{"(1 + 2", "expected next token to be ), got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		p.ParseProgram()
+
+		errs := p.Errors()
+		if assert.NotEmpty(errs, "expected errors for %q", tt.input) {
+			assert.Equal(tt.expectedError, errs[0], "first error for %q", tt.input)
+		}
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	assert := assert.New(t)
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	assert.Len(program.Statements, 1, "program should have 1 statement got %d", len(program.Statements))
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatment)
+	assert.True(ok, "stmt is not *ast.ExpressionStatement got=%T", program.Statements[0])
+
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	assert.True(ok, "stmt.Expression is not *ast.FunctionLiteral got=%T", stmt.Expression)
+
+	assert.Len(function.Parameters, 2)
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	assert.Len(function.Body.Statements, 1)
+	body, ok := function.Body.Statements[0].(*ast.ExpressionStatment)
+	assert.True(ok, "body stmt is not *ast.ExpressionStatement got=%T", function.Body.Statements[0])
+	testInfixExpression(t, body.Expression, "x", "+", "y")
+
+	assert.Equal("fn(x, y) (x + y)", program.String())
+	assert.Equal(len(input), function.End().Offset)
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{"fn() {};", []string{}},
+		{"fn(x) {};", []string{"x"}},
+		{"fn(x, y, z) {};", []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatment)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		assert.Len(function.Parameters, len(tt.expectedParams))
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	assert := assert.New(t)
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	assert.Len(program.Statements, 1, "program should have 1 statement got %d", len(program.Statements))
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatment)
+	assert.True(ok, "stmt is not *ast.ExpressionStatement got=%T", program.Statements[0])
+
+	expr, ok := stmt.Expression.(*ast.CallExpression)
+	assert.True(ok, "stmt.Expression is not *ast.CallExpression got=%T", stmt.Expression)
+
+	testIdentifier(t, expr.Function, "add")
+	assert.Len(expr.Arguments, 3)
+	testLiteralExpression(t, expr.Arguments[0], 1)
+	testInfixExpression(t, expr.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, expr.Arguments[2], 4, "+", 5)
+
+	assert.Equal("1:1", expr.Pos().String())
+	assert.Equal("1:21", expr.End().String())
+}
+
+func TestHigherOrderFunctionParsing(t *testing.T) {
+	assert := assert.New(t)
+	input := "let twice = fn(f, x) { f(f(x)) }; twice(fn(y) { y * 2 }, 3)"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	assert.Equal("let twice = fn(f, x) f(f(x));twice(fn(y) (y * 2), 3)", program.String())
+}
+
+func TestMalformedFunctionsAndCalls(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"fn x { x }", "expected next token to be (, got IDENT instead"},
+		{"fn(x, 1) { x }", "expected next token to be IDENT, got INT instead"},
+		{"fn(x y) { x }", "expected next token to be ), got IDENT instead"},
+		{"fn(x) x", "expected next token to be {, got IDENT instead"},
+		{"add(1, 2", "expected next token to be ), got EOF instead"},
+		{"add(1 2)", "expected next token to be ), got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		p.ParseProgram()
+
+		errs := p.Errors()
+		if assert.NotEmpty(errs, "expected errors for %q", tt.input) {
+			assert.Equal(tt.expectedError, errs[0], "first error for %q", tt.input)
+		}
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	assert := assert.New(t)
+	input := `"hello\tworld";`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	assert.Len(program.Statements, 1, "program should have 1 statement got %d", len(program.Statements))
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatment)
+	assert.True(ok, "stmt is not *ast.ExpressionStatement got=%T", program.Statements[0])
+
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	assert.True(ok, "stmt.Expression is not *ast.StringLiteral got=%T", stmt.Expression)
+	assert.Equal("hello\tworld", literal.Value)
+	assert.Equal(`"hello\tworld"`, input[literal.Pos().Offset:literal.End().Offset])
+}
+
+func TestStringLiteralLexerErrors(t *testing.T) {
+	assert := assert.New(t)
+	input := "let s = \"abc;\n"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	assert.NotNil(program)
+
+	diags := p.Diagnostics()
+	if assert.Len(diags, 1) {
+		assert.Equal("unterminated string literal", diags[0].Message)
+		assert.Equal("1:9", diags[0].Pos.String())
+		assert.Equal(token.TokenType(token.STRING), diags[0].Actual.Type)
+	}
+}
+
+func TestArrayLiteralParsing(t *testing.T) {
+	assert := assert.New(t)
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatment)
+	assert.True(ok, "stmt is not *ast.ExpressionStatement got=%T", program.Statements[0])
+
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	assert.True(ok, "stmt.Expression is not *ast.ArrayLiteral got=%T", stmt.Expression)
+
+	assert.Len(array.Elements, 3)
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+	assert.Equal(len(input), array.End().Offset)
+}
+
+func TestEmptyArrayLiteralParsing(t *testing.T) {
+	assert := assert.New(t)
+
+	l := lexer.New("[]")
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	array, ok := program.Statements[0].(*ast.ExpressionStatment).Expression.(*ast.ArrayLiteral)
+	assert.True(ok)
+	assert.Len(array.Elements, 0)
+}
+
+func TestIndexExpressionParsing(t *testing.T) {
+	assert := assert.New(t)
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatment)
+	assert.True(ok, "stmt is not *ast.ExpressionStatement got=%T", program.Statements[0])
+
+	index, ok := stmt.Expression.(*ast.IndexExpression)
+	assert.True(ok, "stmt.Expression is not *ast.IndexExpression got=%T", stmt.Expression)
+
+	testIdentifier(t, index.Left, "myArray")
+	testInfixExpression(t, index.Index, 1, "+", 1)
+	assert.Equal("1:1", index.Pos().String())
+	assert.Equal(len(input), index.End().Offset)
+}
+
+func TestHashLiteralParsing(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		input    string
+		expected []interface{}
+	}{
+		{`{"one": 1, "two": 2, "three": 3}`, []interface{}{"one", 1, "two", 2, "three", 3}},
+		{`{true: 1, false: 2}`, []interface{}{true, 1, false, 2}},
+		{`{1: 1, 2: 2,}`, []interface{}{1, 1, 2, 2}},
+		{`{}`, []interface{}{}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatment)
+		hash, ok := stmt.Expression.(*ast.HashLiteral)
+		assert.True(ok, "stmt.Expression is not *ast.HashLiteral got=%T", stmt.Expression)
+		assert.Len(hash.Pairs, len(tt.expected)/2)
+
+		for i, pair := range hash.Pairs {
+			key, value := tt.expected[2*i], tt.expected[2*i+1]
+			if str, ok := key.(string); ok {
+				lit, ok := pair.Key.(*ast.StringLiteral)
+				assert.True(ok, "key is not *ast.StringLiteral got=%T", pair.Key)
+				assert.Equal(str, lit.Value)
+			} else {
+				testLiteralExpression(t, pair.Key, key)
+			}
+			testLiteralExpression(t, pair.Value, value)
+		}
+	}
+}
+
+func TestHashLiteralWithExpressions(t *testing.T) {
+	assert := assert.New(t)
+	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	hash := program.Statements[0].(*ast.ExpressionStatment).Expression.(*ast.HashLiteral)
+	assert.Len(hash.Pairs, 3)
+	testInfixExpression(t, hash.Pairs[0].Value, 0, "+", 1)
+	testInfixExpression(t, hash.Pairs[1].Value, 10, "-", 8)
+	testInfixExpression(t, hash.Pairs[2].Value, 15, "/", 5)
+	assert.Equal(`{one: (0 + 1), two: (10 - 8), three: (15 / 5)}`, program.String())
+}
+
+func TestMalformedCollections(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"[1, 2", "expected next token to be ], got EOF instead"},
+		{"xs[1", "expected next token to be ], got EOF instead"},
+		{`{"a" 1}`, "expected next token to be :, got INT instead"},
+		{`{"a": 1 "b": 2}`, "expected next token to be ,, got STRING instead"},
+		{`{"a": 1`, "expected next token to be ,, got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		p.ParseProgram()
+
+		errs := p.Errors()
+		if assert.NotEmpty(errs, "expected errors for %q", tt.input) {
+			assert.Equal(tt.expectedError, errs[0], "first error for %q", tt.input)
+		}
+	}
+}
+
+func TestParsingIgnoresComments(t *testing.T) {
+	assert := assert.New(t)
+	input := `
+	// add two numbers
+	let add = fn(x, y) {
+		x + y; /* the sum */
+	};
+	add(1, /* two */ 2) // call it
+	`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	assert.Equal("let add = fn(x, y) (x + y);add(1, 2)", program.String())
+}
+
+func TestNumericLiteralExpressions(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1_000_000", int64(1000000)},
+		{"0xFF", int64(255)},
+		{"0o17", int64(15)},
+		{"0b1010", int64(10)},
+		{"0", int64(0)},
+		{"3.14", 3.14},
+		{"0.5", 0.5},
+		{"1_000.5", 1000.5},
+		{"1e3", 1000.0},
+		{"2.5E-3", 0.0025},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		assert.Len(program.Statements, 1)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatment)
+		switch expected := tt.expected.(type) {
+		case int64:
+			integ, ok := stmt.Expression.(*ast.IntegerLiteral)
+			if assert.True(ok, "expr is not *ast.IntegerLiteral got=%T", stmt.Expression) {
+				assert.Equal(expected, integ.Value)
+			}
+		case float64:
+			testFloatLiteral(t, stmt.Expression, expected)
+		}
+		assert.Equal(tt.input, stmt.Expression.String())
+	}
+}
+
+func TestMalformedNumericLiterals(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		input         string
+		expectedError string
+		expectedPos   string
+		expectedEnd   string
+	}{
+		{"let x = 0x;", `could not parse "0x" as integer`, "1:9", "1:11"},
+		{"1 + 1__0", `could not parse "1__0" as integer`, "1:5", "1:9"},
+		{"0b102", `could not parse "0b102" as integer`, "1:1", "1:6"},
+		{"99999999999999999999", `could not parse "99999999999999999999" as integer`, "1:1", "1:21"},
+		{"x * 1e", `could not parse "1e" as float`, "1:5", "1:7"},
+		{"1_.5", `could not parse "1_.5" as float`, "1:1", "1:5"},
+		{"010", `could not parse "010" as integer: leading zero, use 0o for octal`, "1:1", "1:4"},
+		{"x + 08", `could not parse "08" as integer: leading zero, use 0o for octal`, "1:5", "1:7"},
+		{"0_1", `could not parse "0_1" as integer: leading zero, use 0o for octal`, "1:1", "1:4"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		p.ParseProgram()
+
+		diags := p.Diagnostics()
+		if assert.Len(diags, 1, "input %q", tt.input) {
+			assert.Equal(tt.expectedError, diags[0].Message)
+			assert.Equal(tt.expectedPos, diags[0].Pos.String())
+			assert.Equal(tt.expectedEnd, diags[0].End.String())
+		}
+	}
+}
+
+func TestLogicalExpressionParsing(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		input    string
+		left     interface{}
+		operator string
+		right    interface{}
+	}{
+		{"a && b", "a", "&&", "b"},
+		{"true || false", true, "||", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		assert.Len(program.Statements, 1)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatment)
+		expr, ok := stmt.Expression.(*ast.LogicalExpression)
+		if !assert.True(ok, "stmt.Expression is not *ast.LogicalExpression got=%T", stmt.Expression) {
+			continue
+		}
+		testLiteralExpression(t, expr.Left, tt.left)
+		assert.Equal(tt.operator, expr.Operator)
+		testLiteralExpression(t, expr.Right, tt.right)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		input          string
+		expectedErrors []string
+		expectedString string
+	}{
+		{
+			"let = 5; let y = 10;",
+			[]string{"expected next token to be IDENT, got = instead"},
+			"<bad statement>let y = 10;",
+		},
+		{
+			"let x 5 + 3\nlet y = 10;",
+			[]string{"expected next token to be =, got INT instead"},
+			"<bad statement>let y = 10;",
+		},
+		{
+			"let x = 1 + ; x",
+			[]string{"no prefix parse function for ; found"},
+			"let x = (1 + <bad expression>);x",
+		},
+		{
+			"let f = fn(x) { let = 1; x }; f(2)",
+			[]string{"expected next token to be IDENT, got = instead"},
+			"let f = fn(x) <bad statement>x;f(2)",
+		},
+		{
+			"let f = fn(x) { x + }; f(2)",
+			[]string{"no prefix parse function for } found"},
+			"let f = fn(x) (x + <bad expression>);f(2)",
+		},
+		{
+			"if (x > ) { 1 } let y = 2; return y",
+			[]string{"no prefix parse function for ) found"},
+			"if(x > <bad expression>) 1let y = 2;return y;",
+		},
+		{
+			"-}",
+			[]string{"no prefix parse function for } found"},
+			"(-<bad expression>)<bad expression>",
+		},
+		{
+			"add(1, 2 * , 3)",
+			[]string{"no prefix parse function for , found"},
+			"add(1, (2 * <bad expression>), 3)",
+		},
+		{
+			"let a = ; let b = ; let c = 3;",
+			[]string{"no prefix parse function for ; found", "no prefix parse function for ; found"},
+			"let a = <bad expression>;let b = <bad expression>;let c = 3;",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		assert.Equal(tt.expectedErrors, p.Errors(), "errors for %q", tt.input)
+		assert.Equal(tt.expectedString, program.String(), "program for %q", tt.input)
+	}
+}
+
+func TestBadStatementSpan(t *testing.T) {
+	assert := assert.New(t)
+
+	input := "let 5 + 3; x"
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	assert.Len(program.Statements, 2)
+	bad, ok := program.Statements[0].(*ast.BadStatement)
+	if assert.True(ok, "stmt is not *ast.BadStatement got=%T", program.Statements[0]) {
+		assert.Equal("let 5 + 3;", input[bad.Pos().Offset:bad.End().Offset])
+	}
+	testIdentifier(t, program.Statements[1].(*ast.ExpressionStatment).Expression, "x")
+}
+
+func TestMaxErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	input := "let = 1; let = 2; let = 3; let = 4;"
+
+	p := parser.New(lexer.New(input))
+	p.ParseProgram()
+	assert.Len(p.Errors(), 4)
+
+	p = parser.New(lexer.New(input))
+	p.SetMaxErrors(2)
+	program := p.ParseProgram()
+	assert.Len(p.Errors(), 2)
+	assert.Len(program.Statements, 2)
+}
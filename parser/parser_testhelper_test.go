@@ -24,8 +24,12 @@ func testLiteralExpression(t *testing.T, expr ast.Expression, expected interface
 		testIntegerLiteral(t, expr, int64(v))
 	case int64:
 		testIntegerLiteral(t, expr, v)
+	case float64:
+		testFloatLiteral(t, expr, v)
 	case string:
 		testIdentifier(t, expr, v)
+	case bool:
+		testBooleanLiteral(t, expr, v)
 	default:
 		t.Errorf("type of expr not handled. got=%T", expr)
 	}
@@ -39,6 +43,21 @@ func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) {
 	assert.Equal(t, integ.TokenLiteral(), fmt.Sprintf("%d", value))
 }
 
+func testFloatLiteral(t *testing.T, expr ast.Expression, value float64) {
+	fl, ok := expr.(*ast.FloatLiteral)
+	assert.True(t, ok, "expr is not *ast.FloatLiteral got=%T", expr)
+
+	assert.Equal(t, value, fl.Value)
+}
+
+func testBooleanLiteral(t *testing.T, expr ast.Expression, value bool) {
+	b, ok := expr.(*ast.Boolean)
+	assert.True(t, ok, "expr is not *ast.Boolean got=%T", expr)
+
+	assert.Equal(t, value, b.Value)
+	assert.Equal(t, fmt.Sprintf("%t", value), b.TokenLiteral())
+}
+
 func testIdentifier(t *testing.T, expr ast.Expression, value string) {
 	ident, ok := expr.(*ast.Identifier)
 	assert.True(t, ok, "expr is not an *ast.Identifier")
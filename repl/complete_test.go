@@ -0,0 +1,20 @@
+package repl
+
+import (
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/object"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComplete(t *testing.T) {
+	s := newSession(nil)
+	s.env.Set("length", &object.Integer{Value: 1})
+	s.env.Set("fib", &object.Integer{Value: 2})
+
+	assert.Equal(t, []string{"length", "let"}, s.complete("le"))
+	assert.Equal(t, []string{"false", "fib", "fn"}, s.complete("f"))
+	assert.Equal(t, []string{"return"}, s.complete("r"))
+	assert.Empty(t, s.complete("zzz"))
+}
@@ -1,30 +1,323 @@
 package repl
 
 import (
-	"bufio"
 	"fmt"
-	"github.com/rsb/monkey_interpreter/token"
-	"github.com/rsb/monkey_interpreter/lexer"
 	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/evaluator"
+	"github.com/rsb/monkey_interpreter/lexer"
+	"github.com/rsb/monkey_interpreter/lineedit"
+	"github.com/rsb/monkey_interpreter/object"
+	"github.com/rsb/monkey_interpreter/parser"
+	"github.com/rsb/monkey_interpreter/token"
 )
 
-const PROMPT = ">> "
+const (
+	PROMPT = ">> "
+	// CONTINUATION_PROMPT is shown while the input is not complete yet
+	CONTINUATION_PROMPT = ".. "
+)
+
+// Mode selects what the REPL does with each input
+type Mode int
+
+const (
+	// ModeEval evaluates the input and prints the result
+	ModeEval Mode = iota
+	// ModeTokens prints the tokens of the input
+	ModeTokens
+	// ModeAST prints the syntax tree of the input
+	ModeAST
+)
+
+var modeNames = map[Mode]string{
+	ModeEval:   "eval",
+	ModeTokens: "tokens",
+	ModeAST:    "ast",
+}
+
+func (m Mode) String() string {
+	return modeNames[m]
+}
+
+const help = `Type Monkey code to run it in the current mode, or a command:
+  :mode [tokens|ast|eval]  show or change what is done with the input
+  :load <file>             run a file as if it was typed in
+  :reset                   forget every binding
+  :env                     list the bindings of the environment
+  :help                    show this message
+Input continues on the next line while it is incomplete, an empty line runs
+it as is.
+`
 
+// Start reads inputs from in until EOF and writes the results to out.
+// Bindings made by one input are visible to the following ones.
+//
+// An input spans several lines when a line leaves a bracket, string or
+// comment open or stops in the middle of a statement. The continuation
+// prompt is shown until the input is complete, or an empty line forces it
+// to be run as is.
+//
+// When in and out are a terminal lines can be edited, the history is kept
+// in the user's configuration directory and Tab completes keywords and
+// bound names
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	s := newSession(out)
+
+	editor := lineedit.New(in, out)
+	if editor.IsTerminal() {
+		editor.Complete = s.complete
+		if history, err := openHistory(); err != nil {
+			fmt.Fprintf(out, "history is not saved: %v\n", err)
+		} else {
+			editor.History = history
+		}
+	}
 
+	var lines []string
 	for {
-		fmt.Printf("%s", PROMPT)
-		scanned := scanner.Scan()
+		prompt := PROMPT
+		if len(lines) > 0 {
+			prompt = CONTINUATION_PROMPT
+		}
 
-		if !scanned {
+		line, err := editor.ReadLine(prompt)
+		if err == lineedit.ErrInterrupted {
+			lines = lines[:0]
+			continue
+		}
+		if err != nil {
+			if len(lines) > 0 {
+				fmt.Fprintln(out)
+				s.run("<stdin>", strings.Join(lines, "\n"))
+			}
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
+		if len(lines) == 0 {
+			if isCommand(line) {
+				s.command(strings.TrimSpace(line))
+				continue
+			}
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+		}
+
+		lines = append(lines, line)
+		src := strings.Join(lines, "\n")
+		if strings.TrimSpace(line) != "" && incomplete(src) {
+			continue
+		}
+
+		s.run("<stdin>", src)
+		lines = lines[:0]
+	}
+}
+
+func openHistory() (*lineedit.History, error) {
+	path, err := lineedit.DefaultHistoryPath("monkey")
+	if err != nil {
+		return nil, err
+	}
+
+	return lineedit.OpenHistory(path, lineedit.DefaultHistorySize)
+}
+
+// complete returns the keywords and the bound names starting with word
+func (s *session) complete(word string) []string {
+	var candidates []string
+	for _, name := range append(token.Keywords(), s.env.Names()...) {
+		if strings.HasPrefix(name, word) {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+
+	return candidates
+}
+
+func isCommand(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), ":")
+}
+
+// incomplete reports whether more lines are needed to finish src: a
+// bracket, string or comment is still open, or the parser ran into the end
+// of the input
+func incomplete(src string) bool {
+	l := lexer.New(src)
+	depth := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		}
+	}
+	if depth > 0 {
+		return true
+	}
+
+	for _, err := range l.Errors() {
+		if strings.HasPrefix(err.Message, "unterminated") {
+			return true
+		}
+	}
+
+	p := parser.New(lexer.New(src))
+	p.ParseProgram()
+	for _, err := range p.Diagnostics() {
+		if err.Actual.Type == token.EOF {
+			return true
+		}
+	}
+
+	return false
+}
+
+// session is the state kept by the REPL between two inputs
+type session struct {
+	out  io.Writer
+	mode Mode
+	env  *object.Environment
+}
+
+func newSession(out io.Writer) *session {
+	return &session{out: out, mode: ModeEval, env: object.NewEnvironment()}
+}
+
+func (s *session) command(line string) {
+	fields := strings.Fields(line)
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case ":mode":
+		if len(args) == 0 {
+			fmt.Fprintf(s.out, "mode: %s\n", s.mode)
+			return
+		}
+		if len(args) > 1 {
+			fmt.Fprintf(s.out, "usage: :mode [tokens|ast|eval]\n")
+			return
+		}
+		for mode, modeName := range modeNames {
+			if args[0] == modeName {
+				s.mode = mode
+				return
+			}
+		}
+		fmt.Fprintf(s.out, "unknown mode %q, want tokens, ast or eval\n", args[0])
+	case ":load":
+		if len(args) != 1 {
+			fmt.Fprintf(s.out, "usage: :load <file>\n")
+			return
+		}
+		src, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			fmt.Fprintf(s.out, "%v\n", err)
+			return
+		}
+		s.run(args[0], string(src))
+	case ":reset":
+		s.env = object.NewEnvironment()
+	case ":env":
+		for _, name := range s.env.Names() {
+			val, _ := s.env.Get(name)
+			fmt.Fprintf(s.out, "%s = %s\n", name, val.Inspect())
+		}
+	case ":help":
+		fmt.Fprint(s.out, help)
+	default:
+		fmt.Fprintf(s.out, "unknown command %s, type :help for the list\n", name)
+	}
+}
+
+// run handles src according to the current mode. filename is used when
+// reporting syntax errors
+func (s *session) run(filename, src string) {
+	if s.mode == ModeTokens {
+		l := lexer.New(src)
 		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+			fmt.Fprintf(s.out, "%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+		}
+		for _, err := range l.Errors() {
+			fmt.Fprintf(s.out, "%s: error: %s\n", err.Pos, err.Message)
 		}
+		return
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if diags := p.Diagnostics(); len(diags) != 0 {
+		parser.Render(s.out, filename, src, diags)
+		return
 	}
+
+	switch s.mode {
+	case ModeAST:
+		printTree(s.out, program)
+	case ModeEval:
+		evaluated := evaluator.Eval(program, s.env)
+		if evaluated != nil && (evaluated.Type() == object.ERROR_OBJ || !isDefinition(program)) {
+			fmt.Fprintf(s.out, "%s\n", evaluated.Inspect())
+		}
+	}
+}
+
+// isDefinition reports whether program has no value worth printing, because
+// it is empty or ends with a let statement
+func isDefinition(program *ast.Program) bool {
+	n := len(program.Statements)
+	if n == 0 {
+		return true
+	}
+	_, ok := program.Statements[n-1].(*ast.LetStatement)
+
+	return ok
+}
+
+// printTree writes one line per node of the tree rooted at node, indented
+// by depth
+func printTree(out io.Writer, node ast.Node) {
+	depth := 0
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+
+		fmt.Fprintf(out, "%s%s", strings.Repeat("  ", depth), strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast."))
+		if detail := nodeDetail(n); detail != "" {
+			fmt.Fprintf(out, " %s", detail)
+		}
+		fmt.Fprintf(out, " %s\n", n.Pos())
+
+		depth++
+		return true
+	})
+}
+
+// nodeDetail returns what distinguishes n from other nodes of its type
+func nodeDetail(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.Identifier:
+		return n.Value
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.Boolean:
+		return n.TokenLiteral()
+	case *ast.StringLiteral:
+		return fmt.Sprintf("%q", n.Value)
+	case *ast.PrefixExpression:
+		return n.Operator
+	case *ast.InfixExpression:
+		return n.Operator
+	case *ast.LogicalExpression:
+		return n.Operator
+	}
+
+	return ""
 }
@@ -0,0 +1,160 @@
+package repl_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/repl"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// session feeds input to the REPL and returns everything it printed
+func session(input string) string {
+	var out bytes.Buffer
+	repl.Start(strings.NewReader(input), &out)
+
+	return out.String()
+}
+
+// run feeds input to the REPL and returns what it printed, without the
+// prompts
+func run(input string) string {
+	return strings.Replace(session(input), repl.PROMPT, "", -1)
+}
+
+func TestEvalKeepsEnvironment(t *testing.T) {
+	input := `let add = fn(a, b) { a + b };
+let x = 2;
+add(x, 3)
+`
+	assert.Equal(t, "5\n", run(input))
+}
+
+func TestModes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":mode\n", "mode: eval\n"},
+		{":mode tokens\n:mode\n", "mode: tokens\n"},
+		{":mode tokens\nx + 1\n", "1:1\tIDENT\t\"x\"\n1:3\t+\t\"+\"\n1:5\tINT\t\"1\"\n"},
+		{":mode ast\n-a + 1\n", `Program 1:1
+  ExpressionStatment 1:1
+    InfixExpression + 1:1
+      PrefixExpression - 1:1
+        Identifier a 1:2
+      IntegerLiteral 1 1:6
+`},
+		{":mode ast\n:mode eval\n1 + 1\n", "2\n"},
+		{":mode bytecode\n", "unknown mode \"bytecode\", want tokens, ast or eval\n"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, run(tt.input), tt.input)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let b = true; let a = [1, 2];\n:env\n", "a = [1, 2]\nb = true\n"},
+		{"let a = 1;\n:reset\n:env\na\n", "ERROR: identifier not found: a\n"},
+		{":nope\n", "unknown command :nope, type :help for the list\n"},
+		{":load\n", "usage: :load <file>\n"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, run(tt.input), tt.input)
+	}
+
+	assert.Contains(t, run(":help\n"), ":mode [tokens|ast|eval]")
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repl")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "lib.mk")
+	err = ioutil.WriteFile(file, []byte("let double = fn(x) {\n  x * 2\n};\n"), 0644)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "42\n", run(":load "+file+"\ndouble(21)\n"))
+	assert.Contains(t, run(":load "+filepath.Join(dir, "missing.mk")+"\n"), "no such file or directory")
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	expected := `error: expected next token to be IDENT, got = instead
+ --> <stdin>:1:5
+  |
+1 | let = 1
+  |     ^
+`
+	assert.Equal(t, expected, run("let = 1\n"))
+}
+
+func TestMultiLineInput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 1\n", ">> 2\n>> "},
+		{"\n\n1\n", ">> >> >> 1\n>> "},
+		{"let f = fn(x) {\n  x * 2\n};\nf(2)\n", ">> .. .. >> 4\n>> "},
+		{"let a = [\n1,\n2\n]\n:env\n", ">> .. .. .. >> a = [1, 2]\n>> "},
+		{"let x =\n  5;\nx\n", ">> .. >> 5\n>> "},
+		{"if (true)\n{ 10 }\n", ">> .. 10\n>> "},
+		{"\"multi\nline\"\n", ">> .. multi\nline\n>> "},
+		{"/* a\ncomment */ 3\n", ">> .. 3\n>> "},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, session(tt.input), tt.input)
+	}
+}
+
+func TestIncompleteInputErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// an empty line runs the pending input
+		{"1 +\n\n2\n", `>> .. error: no prefix parse function for EOF found
+ --> <stdin>:2:1
+  |
+2 | 
+  | ^
+>> 2
+>> `},
+		// so does the end of the input
+		{"f(\n", `>> .. 
+error: no prefix parse function for EOF found
+ --> <stdin>:1:3
+  |
+1 | f(
+  |   ^
+`},
+		// extra closing brackets are an error, not a reason to wait
+		{"(1))\n", `>> error: no prefix parse function for ) found
+ --> <stdin>:1:4
+  |
+1 | (1))
+  |    ^
+>> `},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, session(tt.input), tt.input)
+	}
+}
@@ -1,10 +1,55 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 type TokenType string
 
+// Position describes a location in the source input. Line and Column start
+// at 1, Offset is the byte offset starting at 0
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// IsValid reports whether the position has been set by the lexer
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Comment is a single // or /* */ comment. Text holds the comment as it
+// appears in the source, including the comment markers
+type Comment struct {
+	Text string   `json:"text"`
+	Pos  Position `json:"pos"`
+	End  Position `json:"end"`
+}
+
+// Token is a single lexeme of the input. Pos is the position of the first
+// character of the token and End is the position immediately after it.
+//
+// Leading and Trailing are only set when the lexer attaches comments to
+// tokens. Trailing holds the comments following the token on the same
+// line, Leading every other comment preceding it
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
+	Pos     Position  `json:"pos"`
+	End     Position  `json:"end"`
+
+	Leading  []Comment `json:"leading,omitempty"`
+	Trailing []Comment `json:"trailing,omitempty"`
 }
 
 var keywords = map[string]TokenType{
@@ -17,6 +62,17 @@ var keywords = map[string]TokenType{
 	"return": RETURN,
 }
 
+// Keywords returns every keyword of the language in sorted order
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	return words
+}
+
 // LookupIdent correlates the string with a token type
 func LookupIdent(ident string) TokenType {
 	if tok, ok := keywords[ident]; ok {
@@ -30,10 +86,13 @@ func LookupIdent(ident string) TokenType {
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT"
 
 	// Identifiers + literals
-	IDENT = "IDENT"
-	INT   = "INT"
+	IDENT  = "IDENT"
+	INT    = "INT"
+	FLOAT  = "FLOAT"
+	STRING = "STRING"
 
 	// Operators
 	ASSIGN   = "="
@@ -42,18 +101,26 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 	LT       = "<"
 	GT       = ">"
+	LT_EQ    = "<="
+	GT_EQ    = ">="
 	EQ       = "=="
 	NOT_EQ   = "!="
+	AND      = "&&"
+	OR       = "||"
 
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
 	LPAREN    = "("
 	RPAREN    = ")"
 	LBRACE    = "{"
 	RBRACE    = "}"
+	LBRACKET  = "["
+	RBRACKET  = "]"
 
 	// Keywords
 	FUNCTION = "FUNCTION"
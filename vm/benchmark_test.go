@@ -0,0 +1,51 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/compiler"
+	"github.com/rsb/monkey_interpreter/evaluator"
+	"github.com/rsb/monkey_interpreter/object"
+	"github.com/rsb/monkey_interpreter/vm"
+)
+
+const fibonacci = `
+let fibonacci = fn(x) {
+	if (x < 2) {
+		return x;
+	}
+	fibonacci(x - 1) + fibonacci(x - 2)
+};
+fibonacci(20);
+`
+
+const fibonacci20 = "6765"
+
+func BenchmarkFibonacciVM(b *testing.B) {
+	program := parse(b, fibonacci)
+
+	for i := 0; i < b.N; i++ {
+		c := compiler.New()
+		if err := c.Compile(program); err != nil {
+			b.Fatal(err)
+		}
+
+		machine := vm.New(c.Bytecode())
+		if err := machine.Run(); err != nil {
+			b.Fatal(err)
+		}
+		if result := machine.LastPoppedStackElem().Inspect(); result != fibonacci20 {
+			b.Fatalf("fibonacci(20) = %s, want %s", result, fibonacci20)
+		}
+	}
+}
+
+func BenchmarkFibonacciEval(b *testing.B) {
+	program := parse(b, fibonacci)
+
+	for i := 0; i < b.N; i++ {
+		if result := evaluator.Eval(program, object.NewEnvironment()).Inspect(); result != fibonacci20 {
+			b.Fatalf("fibonacci(20) = %s, want %s", result, fibonacci20)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package vm
+
+import (
+	"github.com/rsb/monkey_interpreter/code"
+	"github.com/rsb/monkey_interpreter/object"
+)
+
+// Frame is the call of a closure: the instruction being run and where its
+// locals start on the stack
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
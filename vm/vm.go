@@ -0,0 +1,599 @@
+// Package vm runs the bytecode produced by package compiler on a stack
+// machine. Running a program gives the same results and the same error
+// messages as evaluating its tree with package evaluator, as long as calls
+// nest less than MaxFrames deep: beyond that the VM stops with a stack
+// overflow where the evaluator goes on until the Go stack is exhausted
+package vm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rsb/monkey_interpreter/code"
+	"github.com/rsb/monkey_interpreter/compiler"
+	"github.com/rsb/monkey_interpreter/object"
+)
+
+const (
+	// StackSize is the initial size of the stack, which grows as calls
+	// nest up to MaxStackSize
+	StackSize    = 2048
+	MaxStackSize = 1 << 22
+	GlobalsSize  = 65536
+	// MaxFrames is the deepest nesting of calls
+	MaxFrames = 1 << 18
+)
+
+var (
+	True  = &object.Boolean{Value: true}
+	False = &object.Boolean{Value: false}
+	Null  = &object.Null{}
+)
+
+type VM struct {
+	constants []object.Object
+	globals   []object.Object
+
+	stack []object.Object
+	sp    int // the top of the stack is stack[sp-1]
+	// underflow is set by pop on an empty stack, which only instructions
+	// not made by the compiler can cause
+	underflow bool
+
+	frames      []*Frame
+	framesIndex int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFrame := NewFrame(&object.Closure{Fn: mainFn}, 0)
+
+	frames := make([]*Frame, 1, 64)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		stack:       make([]object.Object, StackSize),
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// NewWithGlobalsStore returns a VM using s for the globals, so they
+// outlive it
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+
+	return vm
+}
+
+// LastPoppedStackElem returns the value of the last expression statement
+// run, which is the value of the program once Run returned
+func (vm *VM) LastPoppedStackElem() object.Object {
+	if vm.sp >= len(vm.stack) {
+		return nil
+	}
+
+	return vm.stack[vm.sp]
+}
+
+// Run executes the program until its end, a top level return or an error
+func (vm *VM) Run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		var err error
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.push(vm.constants[constIndex])
+		case code.OpPop:
+			vm.pop()
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual,
+			code.OpGreaterThan, code.OpGreaterEqual, code.OpLessThan, code.OpLessEqual:
+			err = vm.executeBinaryOperation(op)
+		case code.OpTrue:
+			err = vm.push(True)
+		case code.OpFalse:
+			err = vm.push(False)
+		case code.OpNull:
+			err = vm.push(Null)
+		case code.OpBang:
+			err = vm.push(nativeBoolToBooleanObject(!isTruthy(vm.pop())))
+		case code.OpMinus:
+			err = vm.executeMinusOperator()
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			if !isTruthy(vm.pop()) {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.globals[globalIndex] = vm.pop()
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.push(vm.global(int(globalIndex)))
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			vm.stack[vm.currentFrame().basePointer+int(localIndex)] = vm.pop()
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			err = vm.push(vm.stack[vm.currentFrame().basePointer+int(localIndex)])
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			err = vm.push(vm.currentFrame().cl.Free[freeIndex])
+		case code.OpGetCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			err = vm.push(cellValue(vm.stack[vm.currentFrame().basePointer+int(localIndex)]))
+		case code.OpSetCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			vm.localCell(int(localIndex)).Value = vm.pop()
+		case code.OpCaptureCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			err = vm.push(vm.localCell(int(localIndex)))
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			err = vm.push(cellValue(vm.currentFrame().cl.Free[freeIndex]))
+		case code.OpCurrentClosure:
+			err = vm.push(vm.currentFrame().cl)
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp -= numElements
+			err = vm.push(array)
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			var hash object.Object
+			if hash, err = vm.buildHash(vm.sp-numElements, vm.sp); err == nil {
+				vm.sp -= numElements
+				err = vm.push(hash)
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.executeIndexExpression(left, index)
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			err = vm.callClosure(int(numArgs))
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if vm.framesIndex == 1 {
+				// a return outside of any function ends the program
+				vm.stack[0] = returnValue
+				vm.sp = 0
+				return nil
+			}
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			err = vm.push(returnValue)
+		case code.OpReturn:
+			if vm.framesIndex == 1 {
+				vm.stack[0] = Null
+				vm.sp = 0
+				return nil
+			}
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			err = vm.push(Null)
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+			err = vm.pushClosure(int(constIndex), int(numFree))
+		default:
+			def, lookupErr := code.Lookup(byte(op))
+			if lookupErr != nil {
+				return lookupErr
+			}
+			return fmt.Errorf("unsupported instruction %s", def.Name)
+		}
+
+		if vm.underflow {
+			return fmt.Errorf("stack underflow")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// global returns the global at index i, null if it was never set: it is
+// bound in a branch that did not run
+func (vm *VM) global(i int) object.Object {
+	if g := vm.globals[i]; g != nil {
+		return g
+	}
+
+	return Null
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= len(vm.stack) && !vm.growStack(vm.sp+1) {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	if vm.sp == 0 {
+		vm.underflow = true
+		return Null
+	}
+
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+
+	return o
+}
+
+// growStack doubles the stack until it holds size slots. It reports false
+// if that exceeds MaxStackSize
+func (vm *VM) growStack(size int) bool {
+	if size > MaxStackSize {
+		return false
+	}
+
+	n := len(vm.stack)
+	for n < size {
+		n *= 2
+	}
+	if n > MaxStackSize {
+		n = MaxStackSize
+	}
+
+	stack := make([]object.Object, n)
+	copy(stack, vm.stack)
+	vm.stack = stack
+
+	return true
+}
+
+func (vm *VM) callClosure(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	cl, ok := callee.(*object.Closure)
+	if !ok {
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if frame.basePointer+cl.Fn.NumLocals > len(vm.stack) && !vm.growStack(frame.basePointer+cl.Fn.NumLocals) {
+		return fmt.Errorf("stack overflow")
+	}
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	// the slots may hold the cells of an earlier call, which OpSetCell
+	// would reuse
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = Null
+	}
+
+	return nil
+}
+
+// localCell returns the cell in the local slot i of the running function,
+// putting a new one in the slot if it holds none: on entry the slot holds
+// null or the argument
+func (vm *VM) localCell(i int) *object.Cell {
+	slot := &vm.stack[vm.currentFrame().basePointer+i]
+	if cell, ok := (*slot).(*object.Cell); ok {
+		return cell
+	}
+
+	cell := &object.Cell{Value: Null}
+	*slot = cell
+
+	return cell
+}
+
+// cellValue returns the value held by o if it is a cell. A local bound in a
+// branch that did not run holds no cell yet
+func cellValue(o object.Object) object.Object {
+	if cell, ok := o.(*object.Cell); ok {
+		return cell.Value
+	}
+
+	return o
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	function, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %s", vm.constants[constIndex].Type())
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp -= numFree
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+	copy(elements, vm.stack[startIndex:endIndex])
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i := index.(*object.Integer).Value
+		if i < 0 || i >= int64(len(elements)) {
+			return vm.push(Null)
+		}
+		return vm.push(elements[i])
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		pair, ok := left.(*object.Hash).Pairs[key.HashKey()]
+		if !ok {
+			return vm.push(Null)
+		}
+		return vm.push(pair.Value)
+	default:
+		return fmt.Errorf("index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	switch operand := vm.pop().(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return fmt.Errorf("unknown operator: -%s", operand.Type())
+	}
+}
+
+// operators gives the source form of binary opcodes, for error messages
+var operators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return vm.executeIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeFloatOperation(op, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return vm.executeStringOperation(op, left, right)
+	case left.Type() != right.Type():
+		return fmt.Errorf("type mismatch: %s %s %s", left.Type(), operators[op], right.Type())
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func (vm *VM) executeIntegerOperation(op code.Opcode, left, right object.Object) error {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	var result int64
+	switch op {
+	case code.OpAdd:
+		result = leftVal + rightVal
+	case code.OpSub:
+		result = leftVal - rightVal
+	case code.OpMul:
+		result = leftVal * rightVal
+	case code.OpDiv, code.OpMod:
+		if rightVal == 0 {
+			return fmt.Errorf("division by zero: %d %s %d", leftVal, operators[op], rightVal)
+		}
+		if op == code.OpDiv {
+			result = leftVal / rightVal
+		} else {
+			result = leftVal % rightVal
+		}
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal == rightVal))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal != rightVal))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftVal > rightVal))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal >= rightVal))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftVal < rightVal))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal <= rightVal))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+
+	return vm.push(&object.Integer{Value: result})
+}
+
+// executeFloatOperation handles arithmetic where at least one operand is a
+// float, the other one is promoted to a float
+func (vm *VM) executeFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	var result float64
+	switch op {
+	case code.OpAdd:
+		result = leftVal + rightVal
+	case code.OpSub:
+		result = leftVal - rightVal
+	case code.OpMul:
+		result = leftVal * rightVal
+	case code.OpDiv, code.OpMod:
+		if rightVal == 0 {
+			return fmt.Errorf("division by zero: %s %s %s", left.Inspect(), operators[op], right.Inspect())
+		}
+		if op == code.OpDiv {
+			result = leftVal / rightVal
+		} else {
+			result = math.Mod(leftVal, rightVal)
+		}
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal == rightVal))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal != rightVal))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftVal > rightVal))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal >= rightVal))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftVal < rightVal))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal <= rightVal))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+
+	return vm.push(&object.Float{Value: result})
+}
+
+func (vm *VM) executeStringOperation(op code.Opcode, left, right object.Object) error {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.String{Value: leftVal + rightVal})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal == rightVal))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftVal != rightVal))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+
+	return obj.(*object.Float).Value
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+
+	return False
+}
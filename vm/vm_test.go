@@ -0,0 +1,163 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/rsb/monkey_interpreter/ast"
+	"github.com/rsb/monkey_interpreter/code"
+	"github.com/rsb/monkey_interpreter/compiler"
+	"github.com/rsb/monkey_interpreter/evaluator"
+	"github.com/rsb/monkey_interpreter/lexer"
+	"github.com/rsb/monkey_interpreter/object"
+	"github.com/rsb/monkey_interpreter/parser"
+	"github.com/rsb/monkey_interpreter/vm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t testing.TB, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	return program
+}
+
+// run compiles and runs input, returning the value of the program or the
+// message of the error it stopped with
+func run(t testing.TB, input string) string {
+	c := compiler.New()
+	if err := c.Compile(parse(t, input)); err != nil {
+		return "ERROR: " + err.(*compiler.Error).Message
+	}
+
+	machine := vm.New(c.Bytecode())
+	if err := machine.Run(); err != nil {
+		return "ERROR: " + err.Error()
+	}
+
+	return machine.LastPoppedStackElem().Inspect()
+}
+
+// programs covers the language, each one has to give the same result on
+// the VM and with Eval
+var programs = []string{
+	// arithmetic and comparisons
+	"1", "1 + 2 * 3 - 4 / 2", "-5 + 10", "7 % 3", "-7 % 3", "2.5 * 2", "1 + 0.5", "7.5 % 2",
+	"1 < 2", "1 > 2", "1 <= 1", "2 >= 3", "1 == 1", "1 != 1", "1 == 1.0", "1.5 < 2",
+	"true == true", "true != false", "(1 < 2) == true", "!true", "!!true", "!5", "!!5",
+	`"mon" + "key"`, `"a" == "a"`, `"a" != "b"`,
+	"[1, 2] == [1, 2]", "let a = [1]; a == a",
+	// logical operators
+	"true && false", "true && 1", "false && 1 / 0", "false || 0", "true || 1 / 0", "1 || 2",
+	"let a = 1; a > 0 && a < 2", "let t = fn() { true }; false || t()",
+	// conditionals
+	"if (true) { 10 }", "if (false) { 10 }", "if (1) { 10 } else { 20 }", "if (null) { 1 } else { 2 }",
+	"if (1 > 2) { 10 } else { 20 }", "if (1 < 2) { }", "if (true) { let x = 1; }",
+	"if (if (false) { 1 }) { 10 } else { 20 }",
+	// bindings
+	"let a = 5; a", "let a = 5; let b = a; let c = a + b + 5; c", "let a = 5;", "",
+	"let x = 1; let x = x + 1; x", "if (true) { let x = 5; } x",
+	// return
+	"return 10; 9", "9; return 2 * 5; 9", "if (10 > 1) { if (10 > 1) { return 10; } return 1; }", "return; 9",
+	// collections
+	"[]", "[1, 2 * 2, 3 + 3]", "[1, 2, 3][0 + 2]", "[1, 2, 3][3]", "[1, 2, 3][-1]",
+	"{}", `{"one": 1, true: 2, 3: 3}["one"]`, `{"one": 1}["two"]`, "{1: 2, 1: 3}[1]", `{"a": [1, {"b": 2}]}["a"][1]["b"]`,
+	// functions and closures
+	"let f = fn() { 5 + 10 }; f()", "let f = fn() { return 1; 2 }; f()", "let f = fn() { }; f()",
+	"let f = fn() { let x = 1; }; f()", "fn(a, b) { a + b }(1, 2)",
+	"let one = fn() { 1 }; let two = fn() { one() + one() }; two()",
+	"let g = 50; let f = fn(a) { let b = a * 2; g - b }; f(5) + f(10)",
+	"let newAdder = fn(a) { fn(b) { a + b } }; let addTwo = newAdder(2); addTwo(3)",
+	"let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3)",
+	"let a = 1; let f = fn() { let a = a + 1; a }; f() + a",
+	"let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(10)",
+	"let f = fn() { let even = fn(n) { if (n == 0) { true } else { !even(n - 1) } }; even(7) }; f()",
+	"let f = fn(f) { f }; f(3)",
+	"fn(a, a) { a }(1, 2)", "fn(a, b, a) { [a, b] }(1, 2, 3)", "fn(a, a) { fn() { a } }(1, 2)()",
+	"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(5000)",
+	"let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(20000)",
+	"let x = 1; let f = fn() { x }; let x = 2; f()",
+	"fn() { let x = 1; let g = fn() { x }; let x = 2; g() }()",
+	"fn(x) { let g = fn() { fn() { x } }; let x = x * 10; g()() }(3)",
+	"let f = fn(n) { let g = fn() { n }; if (n > 0) { let n = n - 1; f(n) + g() } else { g() } }; f(3)",
+	"let mk = fn(n) { let x = n; fn() { x } }; let a = mk(1); let b = mk(2); [a(), b()]",
+	"let f = fn() { if (false) { let x = 1; } let g = fn() { x }; let x = 2; g() }; [f(), f()]",
+	// errors
+	"5 + true", "5 + true; 5", "-true", "true + false", "if (10 > 1) { true + false; }",
+	"let f = fn(x) { x }; f(1, 2)", "let a = 5; a(1)", `"Hello" - "World"`, `"Hello" + 1`,
+	`{"name": "Monkey"}[fn(x) { x }]`, "{[1]: 2}", "1[0]", "[1, 2][true]",
+	"10 / 0", "10 % 0", "1.5 / 0", "let a = 10 / 0; a", `"a" < "b"`, "true < false", "-fn() {}",
+}
+
+func TestMatchesEval(t *testing.T) {
+	for _, input := range programs {
+		expected := evaluator.Eval(parse(t, input), object.NewEnvironment()).Inspect()
+		assert.Equal(t, expected, run(t, input), input)
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { 1 }", "Closure"},
+		{"let f = fn() { f() }; f()", "ERROR: stack overflow"},
+		{"foobar", "ERROR: identifier not found: foobar"},
+	}
+
+	for _, tt := range tests {
+		assert.Contains(t, run(t, tt.input), tt.expected, tt.input)
+	}
+}
+
+// TestRunUnchecked runs instructions the compiler does not produce, which
+// must stop the VM with an error rather than a panic
+func TestRunUnchecked(t *testing.T) {
+	tests := []struct {
+		instructions []byte
+		expected     string
+	}{
+		{code.Make(code.OpPop), "stack underflow"},
+		{append(code.Make(code.OpNull), code.Make(code.OpAdd)...), "stack underflow"},
+		{append(code.Make(code.OpGetGlobal, 7), code.Make(code.OpMinus)...), "unknown operator: -NULL"},
+	}
+
+	for _, tt := range tests {
+		machine := vm.New(&compiler.Bytecode{Instructions: tt.instructions})
+		assert.EqualError(t, machine.Run(), tt.expected)
+	}
+
+	machine := vm.New(&compiler.Bytecode{Instructions: append(code.Make(code.OpReturn), code.Make(code.OpTrue)...)})
+	if assert.NoError(t, machine.Run()) {
+		assert.Equal(t, vm.Null, machine.LastPoppedStackElem())
+	}
+}
+
+func TestGlobalsStore(t *testing.T) {
+	assert := assert.New(t)
+
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbols := compiler.NewSymbolTable()
+	var constants []object.Object
+
+	for _, input := range []string{"let a = 2;", "let f = fn(x) { x * a };", "f(21)"} {
+		c := compiler.NewWithState(symbols, constants)
+		if !assert.NoError(c.Compile(parse(t, input))) {
+			return
+		}
+		bytecode := c.Bytecode()
+		constants = bytecode.Constants
+
+		machine := vm.NewWithGlobalsStore(bytecode, globals)
+		if !assert.NoError(machine.Run()) {
+			return
+		}
+		if input == "f(21)" {
+			assert.Equal("42", machine.LastPoppedStackElem().Inspect())
+		}
+	}
+}